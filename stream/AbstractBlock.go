@@ -1,11 +1,95 @@
 package stream
 
-// AbstractBlock is an abstract struct extended by MemoryBlock and TempFileBlock.
+import (
+  "time"
+)
+
+// AbstractBlock is an abstract struct extended by MemoryBlock, TempFileBlock, ColumnarBlock, and ContentBlock.
 type AbstractBlock struct {
+  ID int `xml:"-" json:"-"` // the identifier assigned to the block by its stream.
+  Count int `xml:"-" json:"-"` // the number of objects in the block, or -1 if unknown.
+  Stats *BlockStats `xml:"-" json:"-"` // the statistics of the keys of the objects in the block, if any.
+  Filter *BloomFilter `xml:"-" json:"-"` // the bloom filter of the keys of the objects in the block, if any.
+  Created time.Time `xml:"-" json:"-"` // the time the block was created, used to evict blocks by age.
+  WindowStart time.Time `xml:"-" json:"-"` // the inclusive start of the time window of the objects in the block, if any.
+  WindowEnd time.Time `xml:"-" json:"-"` // the exclusive end of the time window of the objects in the block, if any.
+  Transform string `xml:"-" json:"-"` // the transform applied to records before compression: prefix, dictionary, or empty for none.
   Algorithm string         `xml:"-" json:"-"` // the compression algorithm used: snappy, gzip, or none.
   BigEndian bool `xml:"-" json:"-"` // If true, then encode numbers using a big-endian byte order, else encodes using littl-endian byte order.
 }
 
+// GetID returns the identifier assigned to the block by its stream.
+func (ab AbstractBlock) GetID() int {
+  return ab.ID
+}
+
+// SetID sets the identifier of the block.
+func (ab *AbstractBlock) SetID(id int) {
+  ab.ID = id
+}
+
+// GetCount returns the number of objects in the block, or -1 if unknown.
+func (ab AbstractBlock) GetCount() int {
+  return ab.Count
+}
+
+// SetCount sets the number of objects in the block.
+func (ab *AbstractBlock) SetCount(count int) {
+  ab.Count = count
+}
+
+// GetStats returns the statistics of the keys of the objects in the block, or nil if none were collected.
+func (ab AbstractBlock) GetStats() *BlockStats {
+  return ab.Stats
+}
+
+// SetStats sets the statistics of the keys of the objects in the block.
+func (ab *AbstractBlock) SetStats(stats *BlockStats) {
+  ab.Stats = stats
+}
+
+// GetFilter returns the bloom filter of the keys of the objects in the block, or nil if none was built.
+func (ab AbstractBlock) GetFilter() *BloomFilter {
+  return ab.Filter
+}
+
+// SetFilter sets the bloom filter of the keys of the objects in the block.
+func (ab *AbstractBlock) SetFilter(filter *BloomFilter) {
+  ab.Filter = filter
+}
+
+// GetCreated returns the time the block was created.
+func (ab AbstractBlock) GetCreated() time.Time {
+  return ab.Created
+}
+
+// SetCreated sets the time the block was created.
+func (ab *AbstractBlock) SetCreated(created time.Time) {
+  ab.Created = created
+}
+
+// GetWindow returns the inclusive start and exclusive end of the time window of the objects in the block,
+// or zero times if the block is not windowed.
+func (ab AbstractBlock) GetWindow() (time.Time, time.Time) {
+  return ab.WindowStart, ab.WindowEnd
+}
+
+// SetWindow sets the start and end of the time window of the objects in the block.
+func (ab *AbstractBlock) SetWindow(start time.Time, end time.Time) {
+  ab.WindowStart = start
+  ab.WindowEnd = end
+}
+
+// GetTransform returns the transform applied to records before compression, or empty if none.
+func (ab AbstractBlock) GetTransform() string {
+  return ab.Transform
+}
+
+// SetTransform sets the transform applied to records before compression.
+func (ab *AbstractBlock) SetTransform(transform string) {
+  ab.Transform = transform
+}
+
 // Returns the compress algorithm, which can be: snappy, gzip, or none.
 func (ab AbstractBlock) GetAlgorithm() string {
   return ab.Algorithm
@@ -7,9 +7,27 @@
 
 package stream
 
+import (
+  "time"
+)
+
 // Block is an interface for a compressed array of objects in a binary representation
 type Block interface {
   Init(b []byte) error // initialize block
+  GetID() int // get identifier of block
+  SetID(id int) // set identifier of block
+  GetCount() int // get number of objects in block, or -1 if unknown
+  SetCount(count int) // set number of objects in block
+  GetStats() *BlockStats // get statistics of keys in block, or nil
+  SetStats(stats *BlockStats) // set statistics of keys in block
+  GetFilter() *BloomFilter // get bloom filter of keys in block, or nil
+  SetFilter(filter *BloomFilter) // set bloom filter of keys in block
+  GetCreated() time.Time // get time the block was created
+  SetCreated(created time.Time) // set time the block was created
+  GetWindow() (time.Time, time.Time) // get start and end of time window of objects in block, or zero times if none
+  SetWindow(start time.Time, end time.Time) // set start and end of time window of objects in block
+  GetTransform() string // get transform applied to records before compression, or empty if none
+  SetTransform(transform string) // set transform applied to records before compression
   Size() (int64, error) // get size of block in bytes
   Reader() (*Reader, error) // get reader for this block
   Iterator() (*BlockIterator, error) // get iterator for this block
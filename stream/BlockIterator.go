@@ -23,6 +23,8 @@ var MAXIMUM_SLICE_LENGTH = 400
 type BlockIterator struct {
   Reader *Reader
   BigEndian bool
+  Transform string // the transform applied to records before compression, which Next reverses
+  transform *recordTransform
 }
 
 // Next returns the bytes of the next object in the block, and an error if any.
@@ -70,6 +72,21 @@ func (it *BlockIterator) Next() ([]byte, error) {
     }
   }
 
+  if it.Transform != "" {
+    if it.transform == nil {
+      t, err := newRecordTransform(it.Transform)
+      if err != nil {
+        return []byte{}, err
+      }
+      it.transform = t
+    }
+    record, err := it.transform.decode(content)
+    if err != nil {
+      return []byte{}, errors.Wrap(err, "Error decoding record.")
+    }
+    return record, nil
+  }
+
   return content, nil
 }
 
@@ -0,0 +1,82 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+)
+
+// BlockStats are the statistics of the keys of the objects in a block, collected using Stream.KeyFunc.
+// A nil key is counted as a null and is not included in the minimum or maximum.
+type BlockStats struct {
+	MinKey    []byte `xml:"-" json:"min"`       // the minimum key, or nil if every key is null
+	MaxKey    []byte `xml:"-" json:"max"`       // the maximum key, or nil if every key is null
+	Count     int    `xml:"count" json:"count"` // the number of keys
+	NullCount int    `xml:"nulls" json:"nulls"` // the number of null keys
+}
+
+// Add adds a key to the statistics.
+func (bs *BlockStats) Add(key []byte) {
+	bs.Count += 1
+	if key == nil {
+		bs.NullCount += 1
+		return
+	}
+	if bs.MinKey == nil || bytes.Compare(key, bs.MinKey) < 0 {
+		bs.MinKey = append(make([]byte, 0, len(key)), key...)
+	}
+	if bs.MaxKey == nil || bytes.Compare(key, bs.MaxKey) > 0 {
+		bs.MaxKey = append(make([]byte, 0, len(key)), key...)
+	}
+}
+
+// Predicate is a condition on the keys of objects used by Stream.Scan.
+type Predicate interface {
+	MayMatch(stats *BlockStats) bool // returns false if no key described by the statistics can match
+	Match(key []byte) bool           // returns true if the key matches
+}
+
+// KeyRange is a Predicate that matches keys between Min and Max inclusive.
+// If Min or Max is nil, then the range is unbounded on that side.  Null keys never match.
+type KeyRange struct {
+	Min []byte
+	Max []byte
+}
+
+// KeyEquals returns a KeyRange that matches only the given key.
+func KeyEquals(key []byte) KeyRange {
+	return KeyRange{Min: key, Max: key}
+}
+
+// MayMatch returns false if no key described by the statistics is in the range.
+func (kr KeyRange) MayMatch(stats *BlockStats) bool {
+	if stats.Count == stats.NullCount {
+		return false
+	}
+	if kr.Min != nil && bytes.Compare(stats.MaxKey, kr.Min) < 0 {
+		return false
+	}
+	if kr.Max != nil && bytes.Compare(stats.MinKey, kr.Max) > 0 {
+		return false
+	}
+	return true
+}
+
+// Match returns true if the key is in the range.
+func (kr KeyRange) Match(key []byte) bool {
+	if key == nil {
+		return false
+	}
+	if kr.Min != nil && bytes.Compare(key, kr.Min) < 0 {
+		return false
+	}
+	if kr.Max != nil && bytes.Compare(key, kr.Max) > 0 {
+		return false
+	}
+	return true
+}
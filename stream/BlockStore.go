@@ -0,0 +1,193 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+import (
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// BlockStore is an interface for a content-addressed store of compressed blocks shared by streams.
+// Every unique block is stored once under the hex-encoded SHA-256 digest of its bytes,
+// and is deleted once every reference to it is released.
+type BlockStore interface {
+	Put(b []byte) (string, error)      // store the bytes, if not already stored, add a reference, and return the digest
+	Get(digest string) ([]byte, error) // get the bytes stored under the digest
+	Release(digest string) error       // remove a reference, and delete the bytes if no reference remains
+	Refs(digest string) int            // get the number of references to the digest
+}
+
+// Digest returns the hex-encoded SHA-256 digest of the bytes.
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryBlockStore is a BlockStore that holds blocks in memory.
+type MemoryBlockStore struct {
+	mutex sync.Mutex
+	blobs map[string][]byte
+	refs  map[string]int
+}
+
+// NewMemoryBlockStore returns a new empty MemoryBlockStore.
+func NewMemoryBlockStore() *MemoryBlockStore {
+	return &MemoryBlockStore{
+		blobs: map[string][]byte{},
+		refs:  map[string]int{},
+	}
+}
+
+// Put stores the bytes, if not already stored, adds a reference, and returns the digest.
+func (ms *MemoryBlockStore) Put(b []byte) (string, error) {
+	digest := Digest(b)
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.blobs[digest]; !ok {
+		ms.blobs[digest] = append(make([]byte, 0, len(b)), b...)
+	}
+	ms.refs[digest] += 1
+	return digest, nil
+}
+
+// Get returns the bytes stored under the digest, and an error if any.
+func (ms *MemoryBlockStore) Get(digest string) ([]byte, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	b, ok := ms.blobs[digest]
+	if !ok {
+		return nil, errors.New("Error getting block " + digest + ".  Block does not exist.")
+	}
+	return b, nil
+}
+
+// Release removes a reference to the digest, and deletes the bytes if no reference remains.
+func (ms *MemoryBlockStore) Release(digest string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if ms.refs[digest] <= 0 {
+		return errors.New("Error releasing block " + digest + ".  Block has no references.")
+	}
+	ms.refs[digest] -= 1
+	if ms.refs[digest] == 0 {
+		delete(ms.refs, digest)
+		delete(ms.blobs, digest)
+	}
+	return nil
+}
+
+// Refs returns the number of references to the digest.
+func (ms *MemoryBlockStore) Refs(digest string) int {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return ms.refs[digest]
+}
+
+// DirBlockStore is a BlockStore that writes every block to a file named by its digest in a directory.
+// The references are counted in memory, so every stream sharing the directory must share the same DirBlockStore.
+type DirBlockStore struct {
+	Dir   string `xml:"-" json:"-"` // the directory of the blocks, which may start with ~
+	mutex sync.Mutex
+	refs  map[string]int
+}
+
+// NewDirBlockStore returns a new DirBlockStore that writes blocks to the directory, creating it if needed.
+func NewDirBlockStore(dir string) (*DirBlockStore, error) {
+	dirExpanded, err := homedir.Expand(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error expanding path for block store at \""+dir+"\"")
+	}
+	err = os.MkdirAll(dirExpanded, 0770)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating directory for block store at \""+dirExpanded+"\"")
+	}
+	return &DirBlockStore{Dir: dirExpanded, refs: map[string]int{}}, nil
+}
+
+// path returns the path to the file of the digest.
+func (ds *DirBlockStore) path(digest string) string {
+	return filepath.Join(ds.Dir, digest)
+}
+
+// Put writes the bytes to a file, if not already written, adds a reference, and returns the digest.
+// The file is written to a temp file first and then renamed, so readers never see a partial block.
+func (ds *DirBlockStore) Put(b []byte) (string, error) {
+	digest := Digest(b)
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if _, err := os.Stat(ds.path(digest)); os.IsNotExist(err) {
+		f, err := ioutil.TempFile(ds.Dir, "go_blockstore_")
+		if err != nil {
+			return "", errors.Wrap(err, "Error creating temp file in directory \""+ds.Dir+"\"")
+		}
+		_, err = f.Write(b)
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), ds.path(digest))
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return "", errors.Wrap(err, "Error writing block "+digest+" to directory \""+ds.Dir+"\"")
+		}
+	} else if err != nil {
+		return "", errors.Wrap(err, "Error checking for block "+digest+" in directory \""+ds.Dir+"\"")
+	}
+
+	ds.refs[digest] += 1
+	return digest, nil
+}
+
+// Get returns the bytes in the file of the digest, and an error if any.
+func (ds *DirBlockStore) Get(digest string) ([]byte, error) {
+	b, err := ioutil.ReadFile(ds.path(digest))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading block "+digest+" from directory \""+ds.Dir+"\"")
+	}
+	return b, nil
+}
+
+// Release removes a reference to the digest, and deletes the file if no reference remains.
+func (ds *DirBlockStore) Release(digest string) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	if ds.refs[digest] <= 0 {
+		return errors.New("Error releasing block " + digest + ".  Block has no references.")
+	}
+	ds.refs[digest] -= 1
+	if ds.refs[digest] > 0 {
+		return nil
+	}
+	delete(ds.refs, digest)
+	err := os.Remove(ds.path(digest))
+	if err != nil {
+		return errors.Wrap(err, "Error removing block "+digest+" from directory \""+ds.Dir+"\"")
+	}
+	return nil
+}
+
+// Refs returns the number of references to the digest.
+func (ds *DirBlockStore) Refs(digest string) int {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	return ds.refs[digest]
+}
@@ -0,0 +1,73 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"testing"
+)
+
+// newStoreStream returns a new closed stream of 10 equal objects in 2 blocks kept in the store.
+func newStoreStream(t *testing.T, store BlockStore) *Stream {
+	t.Helper()
+	s, err := New("snappy", "little", 5, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Store = store
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err := s.Append([]byte("ref"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	return s
+}
+
+func TestBlockStore(t *testing.T) {
+	dir := t.TempDir()
+	dirStore, err := NewDirBlockStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []BlockStore{NewMemoryBlockStore(), dirStore} {
+		a := newStoreStream(t, store)
+		b := newStoreStream(t, store)
+		digest := a.Blocks[0].(*ContentBlock).Digest
+		// The 2 identical blocks of each stream share one copy.
+		if n := store.Refs(digest); n != 4 {
+			t.Fatalf("expected 4 references but found %d", n)
+		}
+		size, err := a.Blocks[0].Size()
+		if err != nil || size <= 0 {
+			t.Fatal(size, err)
+		}
+		a.Remove()
+		if n := store.Refs(digest); n != 2 {
+			t.Fatalf("expected 2 references but found %d", n)
+		}
+		if n := len(readStream(t, b)); n != 10 {
+			t.Fatalf("expected 10 objects but found %d", n)
+		}
+		b.Remove()
+		if n := store.Refs(digest); n != 0 {
+			t.Fatalf("expected no references but found %d", n)
+		}
+		_, err = store.Get(digest)
+		if err == nil {
+			t.Fatal("expected the block to be deleted from the store")
+		}
+	}
+	if n := countFiles(t, dir); n != 0 {
+		t.Fatalf("expected no files left in the store but found %d", n)
+	}
+}
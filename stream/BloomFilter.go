@@ -0,0 +1,105 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// BloomFilter is a probabilistic set of keys with a bounded size.
+// MayContain never returns false for a key that was added, but may return true for a key that was not.
+type BloomFilter struct {
+	Bits   []uint64 `xml:"-" json:"-"` // the bit array
+	Hashes int      `xml:"-" json:"-"` // the number of hash functions
+}
+
+// NewBloomFilter returns a new BloomFilter sized for n keys with the false positive rate p.
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := int(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := int(math.Floor(float64(m)/float64(n)*math.Ln2 + 0.5))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		Bits:   make([]uint64, (m+63)/64),
+		Hashes: k,
+	}
+}
+
+// bloomHash returns the hash pair used to derive the bit locations of the key.
+func bloomHash(key []byte) [2]uint64 {
+	h := fnv.New128a()
+	h.Write(key)
+	sum := h.Sum(nil)
+	return [2]uint64{binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16]) | 1}
+}
+
+// Add adds the key to the filter.
+func (bf *BloomFilter) Add(key []byte) {
+	bf.addHash(bloomHash(key))
+}
+
+// addHash adds the key with the given hash pair to the filter.
+func (bf *BloomFilter) addHash(hash [2]uint64) {
+	h1, h2 := hash[0], hash[1]
+	m := uint64(len(bf.Bits) * 64)
+	for i := 0; i < bf.Hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		bf.Bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain returns true if the key may have been added to the filter, and false if it definitely was not.
+func (bf *BloomFilter) MayContain(key []byte) bool {
+	hash := bloomHash(key)
+	h1, h2 := hash[0], hash[1]
+	m := uint64(len(bf.Bits) * 64)
+	for i := 0; i < bf.Hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if bf.Bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the filter as bytes, and returns an error if any.
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8+8*len(bf.Bits))
+	binary.BigEndian.PutUint64(b[0:8], uint64(bf.Hashes))
+	for i, x := range bf.Bits {
+		binary.BigEndian.PutUint64(b[8+8*i:16+8*i], x)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a filter encoded with MarshalBinary, and returns an error if any.
+func (bf *BloomFilter) UnmarshalBinary(b []byte) error {
+	if len(b) < 16 || len(b)%8 != 0 {
+		return errors.New("Invalid bloom filter length " + fmt.Sprint(len(b)) + ".")
+	}
+	bf.Hashes = int(binary.BigEndian.Uint64(b[0:8]))
+	bf.Bits = make([]uint64, (len(b)-8)/8)
+	for i := range bf.Bits {
+		bf.Bits[i] = binary.BigEndian.Uint64(b[8+8*i : 16+8*i])
+	}
+	return nil
+}
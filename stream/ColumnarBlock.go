@@ -0,0 +1,412 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+import (
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+)
+
+const (
+	FieldInt    = "int"    // values are int64 and are delta encoded
+	FieldString = "string" // values are string and are dictionary encoded
+	FieldBool   = "bool"   // values are bool and are run-length encoded
+)
+
+// Field is a field of a record stored as a column in a ColumnarBlock.
+type Field struct {
+	Name string `xml:"name" json:"name"`
+	Type string `xml:"type" json:"type"` // int, string, or bool
+}
+
+// FieldExtractor splits records into the values of their fields and builds records from the values.
+// The values are in the order of Fields.  Values of int fields are int64, string fields are string, and bool fields are bool.
+type FieldExtractor interface {
+	Fields() []Field                            // the fields of every record
+	Extract(b []byte) ([]interface{}, error)    // returns the values of the fields of the record
+	Build(values []interface{}) ([]byte, error) // returns the record with the values
+}
+
+// ColumnarBlock holds a block of records in memory as one column per field.
+// Each column is encoded by the type of its field and then compressed using the Algorithm.
+// Records are rebuilt from the columns by Get and Iterator, which return them without any record transform.
+type ColumnarBlock struct {
+	AbstractBlock
+	Extractor FieldExtractor `xml:"-" json:"-"`
+	Columns   [][]byte       `xml:"-" json:"-"` // the compressed columns in the order of the extractor's fields
+}
+
+// Size returns the number of bytes in every column as an int64.
+func (cb *ColumnarBlock) Size() (int64, error) {
+	n := int64(0)
+	for _, column := range cb.Columns {
+		n += int64(len(column))
+	}
+	return n, nil
+}
+
+// Init initializes the columns from a buffer of records compressed using the Algorithm, as written by a Stream.
+func (cb *ColumnarBlock) Init(b []byte) error {
+	if cb.Extractor == nil {
+		return errors.New("Error initializing columnar block.  Extractor is nil.")
+	}
+	fields := cb.Extractor.Fields()
+
+	rows := NewMemoryBlock(cb.Algorithm, cb.BigEndian)
+	rows.SetTransform(cb.Transform)
+	err := rows.Init(b)
+	if err != nil {
+		return errors.Wrap(err, "Error initializing rows")
+	}
+	it, err := rows.Iterator()
+	if err != nil {
+		return errors.Wrap(err, "Error creating iterator for rows")
+	}
+	defer it.Close()
+
+	values := make([][]interface{}, len(fields))
+	for {
+		record, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrap(err, "Error reading record")
+		}
+		v, err := cb.Extractor.Extract(record)
+		if err != nil {
+			return errors.Wrap(err, "Error extracting fields from record")
+		}
+		if len(v) != len(fields) {
+			return errors.New("Error extracting fields from record.  Expecting " + fmt.Sprint(len(fields)) + " values but found " + fmt.Sprint(len(v)) + ".")
+		}
+		for i := range fields {
+			values[i] = append(values[i], v[i])
+		}
+	}
+
+	columns := make([][]byte, len(fields))
+	for i, field := range fields {
+		column, err := encodeColumn(field.Type, values[i])
+		if err != nil {
+			return errors.Wrap(err, "Error encoding column \""+field.Name+"\"")
+		}
+		columns[i], err = compressBytes(cb.Algorithm, column)
+		if err != nil {
+			return errors.Wrap(err, "Error compressing column \""+field.Name+"\"")
+		}
+	}
+	cb.Columns = columns
+	return nil
+}
+
+// records returns every record rebuilt from the columns.
+func (cb *ColumnarBlock) records() ([][]byte, error) {
+	if cb.Extractor == nil {
+		return nil, errors.New("Error reading columnar block.  Extractor is nil.")
+	}
+	fields := cb.Extractor.Fields()
+	if len(fields) != len(cb.Columns) {
+		return nil, errors.New("Error reading columnar block.  Expecting " + fmt.Sprint(len(fields)) + " columns but found " + fmt.Sprint(len(cb.Columns)) + ".")
+	}
+
+	values := make([][]interface{}, len(fields))
+	for i, field := range fields {
+		column, err := decompressBytes(cb.Algorithm, cb.Columns[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "Error decompressing column \""+field.Name+"\"")
+		}
+		values[i], err = decodeColumn(field.Type, column)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error decoding column \""+field.Name+"\"")
+		}
+		if len(values[i]) != len(values[0]) {
+			return nil, errors.New("Error decoding column \"" + field.Name + "\".  Column has " + fmt.Sprint(len(values[i])) + " values but expecting " + fmt.Sprint(len(values[0])) + ".")
+		}
+	}
+
+	n := 0
+	if len(values) > 0 {
+		n = len(values[0])
+	}
+	records := make([][]byte, 0, n)
+	for r := 0; r < n; r++ {
+		row := make([]interface{}, len(fields))
+		for i := range fields {
+			row[i] = values[i][r]
+		}
+		record, err := cb.Extractor.Build(row)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error building record "+fmt.Sprint(r))
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Reader returns a *Reader for reading the rebuilt records as uncompressed objects, and an error if any.
+func (cb *ColumnarBlock) Reader() (*Reader, error) {
+	records, err := cb.records()
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	for _, record := range records {
+		if cb.BigEndian {
+			binary.Write(buf, binary.BigEndian, uint64(len(record)))
+		} else {
+			binary.Write(buf, binary.LittleEndian, uint64(len(record)))
+		}
+		buf.Write(record)
+	}
+	return &Reader{Reader: buf}, nil
+}
+
+// Iterator returns a BlockIterator for iterating through the rebuilt records, and an error if any.
+func (cb *ColumnarBlock) Iterator() (*BlockIterator, error) {
+	reader, err := cb.Reader()
+	if err != nil {
+		return &BlockIterator{}, errors.Wrap(err, "Error creating iterator")
+	}
+	it := &BlockIterator{
+		Reader:    reader,
+		BigEndian: cb.UseBigEndian(),
+	}
+	return it, nil
+}
+
+// Get returns the record at an arbitrary position, and an error if any.
+// Every column is decoded, so only use this function for random access.
+func (cb *ColumnarBlock) Get(position int) ([]byte, error) {
+	records, err := cb.records()
+	if err != nil {
+		return make([]byte, 0), errors.Wrap(err, "Error getting record at position "+fmt.Sprint(position)+" in block")
+	}
+	if position < 0 || position >= len(records) {
+		return make([]byte, 0), errors.Wrap(io.EOF, "Error getting record at position "+fmt.Sprint(position)+" in block with "+fmt.Sprint(len(records))+" records")
+	}
+	return records[position], nil
+}
+
+// Remove clears the columns.
+func (cb *ColumnarBlock) Remove() error {
+	cb.Columns = make([][]byte, 0)
+	return nil
+}
+
+// NewColumnarBlock returns a new ColumnarBlock that uses the extractor to split records into columns.
+// Algorithm can be snappy, gzip, or none.
+func NewColumnarBlock(algorithm string, bigEndian bool, extractor FieldExtractor) *ColumnarBlock {
+	return &ColumnarBlock{
+		AbstractBlock: AbstractBlock{
+			Count:     -1,
+			Algorithm: algorithm,
+			BigEndian: bigEndian,
+		},
+		Extractor: extractor,
+	}
+}
+
+// encodeColumn returns the values encoded by the field type, prefixed by the number of values as a uvarint.
+// Ints are encoded as varint deltas from the previous value.
+// Strings are encoded as a dictionary of distinct values followed by the uvarint index of every value.
+// Bools are encoded as runs of a value byte followed by the uvarint length of the run.
+func encodeColumn(fieldType string, values []interface{}) ([]byte, error) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	out := new(bytes.Buffer)
+	putUvarint := func(x uint64) { out.Write(buf[:binary.PutUvarint(buf, x)]) }
+	putUvarint(uint64(len(values)))
+
+	switch fieldType {
+	case FieldInt:
+		previous := int64(0)
+		for i, v := range values {
+			x, ok := v.(int64)
+			if !ok {
+				return nil, errors.New("Invalid value at row " + fmt.Sprint(i) + ".  Expecting int64 but found " + fmt.Sprintf("%T", v) + ".")
+			}
+			out.Write(buf[:binary.PutVarint(buf, x-previous)])
+			previous = x
+		}
+	case FieldString:
+		dictionary := map[string]uint64{}
+		entries := make([]string, 0)
+		indices := make([]uint64, 0, len(values))
+		for i, v := range values {
+			x, ok := v.(string)
+			if !ok {
+				return nil, errors.New("Invalid value at row " + fmt.Sprint(i) + ".  Expecting string but found " + fmt.Sprintf("%T", v) + ".")
+			}
+			index, ok := dictionary[x]
+			if !ok {
+				index = uint64(len(entries))
+				dictionary[x] = index
+				entries = append(entries, x)
+			}
+			indices = append(indices, index)
+		}
+		putUvarint(uint64(len(entries)))
+		for _, entry := range entries {
+			putUvarint(uint64(len(entry)))
+			out.WriteString(entry)
+		}
+		for _, index := range indices {
+			putUvarint(index)
+		}
+	case FieldBool:
+		for i := 0; i < len(values); {
+			x, ok := values[i].(bool)
+			if !ok {
+				return nil, errors.New("Invalid value at row " + fmt.Sprint(i) + ".  Expecting bool but found " + fmt.Sprintf("%T", values[i]) + ".")
+			}
+			j := i + 1
+			for j < len(values) && values[j] == x {
+				j++
+			}
+			if x {
+				out.WriteByte(1)
+			} else {
+				out.WriteByte(0)
+			}
+			putUvarint(uint64(j - i))
+			i = j
+		}
+	default:
+		return nil, errors.New("Unknown field type \"" + fieldType + "\"")
+	}
+
+	return out.Bytes(), nil
+}
+
+// decodeColumn returns the values of a column encoded with encodeColumn.
+func decodeColumn(fieldType string, b []byte) ([]interface{}, error) {
+	r := bytes.NewReader(b)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading number of values")
+	}
+	values := make([]interface{}, 0)
+
+	switch fieldType {
+	case FieldInt:
+		previous := int64(0)
+		for uint64(len(values)) < n {
+			delta, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading delta")
+			}
+			previous += delta
+			values = append(values, previous)
+		}
+	case FieldString:
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading dictionary size")
+		}
+		if size > uint64(len(b)) {
+			return nil, errors.New("Invalid dictionary size " + fmt.Sprint(size) + ".")
+		}
+		entries := make([]string, 0, size)
+		for uint64(len(entries)) < size {
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading dictionary entry length")
+			}
+			if length > uint64(r.Len()) {
+				return nil, errors.New("Invalid dictionary entry length " + fmt.Sprint(length) + ".")
+			}
+			entry := make([]byte, length)
+			_, err = io.ReadFull(r, entry)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading dictionary entry")
+			}
+			entries = append(entries, string(entry))
+		}
+		for uint64(len(values)) < n {
+			index, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading dictionary index")
+			}
+			if index >= uint64(len(entries)) {
+				return nil, errors.New("Invalid dictionary index " + fmt.Sprint(index) + ".")
+			}
+			values = append(values, entries[index])
+		}
+	case FieldBool:
+		for uint64(len(values)) < n {
+			x, err := r.ReadByte()
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading run value")
+			}
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error reading run length")
+			}
+			if length > n-uint64(len(values)) {
+				return nil, errors.New("Invalid run length " + fmt.Sprint(length) + ".")
+			}
+			for i := uint64(0); i < length; i++ {
+				values = append(values, x == 1)
+			}
+		}
+	default:
+		return nil, errors.New("Unknown field type \"" + fieldType + "\"")
+	}
+
+	return values, nil
+}
+
+// compressBytes returns the bytes compressed using the algorithm: snappy, gzip, or none.
+func compressBytes(algorithm string, b []byte) ([]byte, error) {
+	switch algorithm {
+	case "snappy":
+		return snappy.Encode(nil, b), nil
+	case "gzip":
+		buf := new(bytes.Buffer)
+		gw := gzip.NewWriter(buf)
+		_, err := gw.Write(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error writing gzip bytes")
+		}
+		err = gw.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error closing gzip writer")
+		}
+		return buf.Bytes(), nil
+	case "none":
+		return b, nil
+	}
+	return nil, errors.New("Unknown compression algorithm \"" + algorithm + "\"")
+}
+
+// decompressBytes returns the bytes decompressed using the algorithm: snappy, gzip, or none.
+func decompressBytes(algorithm string, b []byte) ([]byte, error) {
+	switch algorithm {
+	case "snappy":
+		return snappy.Decode(nil, b)
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating gzip reader")
+		}
+		defer gr.Close()
+		return ioutil.ReadAll(gr)
+	case "none":
+		return b, nil
+	}
+	return nil, errors.New("Unknown compression algorithm \"" + algorithm + "\"")
+}
@@ -0,0 +1,210 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// csvExtractor splits records of an int, a string, and a bool separated by commas into columns.
+type csvExtractor struct{}
+
+func (csvExtractor) Fields() []Field {
+	return []Field{{"id", FieldInt}, {"name", FieldString}, {"ok", FieldBool}}
+}
+
+func (csvExtractor) Extract(b []byte) ([]interface{}, error) {
+	parts := strings.Split(string(b), ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid record %q", b)
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{id, parts[1], parts[2] == "t"}, nil
+}
+
+func (csvExtractor) Build(values []interface{}) ([]byte, error) {
+	ok := "f"
+	if values[2].(bool) {
+		ok = "t"
+	}
+	return []byte(fmt.Sprintf("%d,%s,%s", values[0], values[1], ok)), nil
+}
+
+// csvRecord returns the record written at position i by newColumnarStream.
+func csvRecord(i int) string {
+	ok := "f"
+	if i/4%2 == 0 {
+		ok = "t"
+	}
+	return fmt.Sprintf("%d,n%d,%s", i*3-20, i%3, ok)
+}
+
+// newColumnarStream returns a new closed columnar stream with n records.
+func newColumnarStream(t *testing.T, algorithm string, n int) *Stream {
+	t.Helper()
+	s, err := New(algorithm, "big", 10, "columnar", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Extractor = csvExtractor{}
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err := s.Append([]byte(csvRecord(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// csvName returns the name field of a record.
+func csvName(b []byte) []byte {
+	return bytes.Split(b, []byte(","))[1]
+}
+
+func TestColumnarBlock(t *testing.T) {
+	for _, algorithm := range []string{"snappy", "gzip", "none"} {
+		s := newColumnarStream(t, algorithm, 25)
+		objects := readStream(t, s)
+		if len(objects) != 25 {
+			t.Fatalf("expected 25 objects but found %d", len(objects))
+		}
+		for i, object := range objects {
+			if object != csvRecord(i) {
+				t.Fatalf("expected %q at position %d but found %q", csvRecord(i), i, object)
+			}
+		}
+		b, err := s.Get(13)
+		if err != nil || string(b) != csvRecord(13) {
+			t.Fatal(string(b), err)
+		}
+		err = s.Compact(100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(readStream(t, s)); n != 25 {
+			t.Fatalf("expected 25 objects but found %d", n)
+		}
+	}
+}
+
+func TestColumnarDerived(t *testing.T) {
+	s := newColumnarStream(t, "snappy", 25)
+
+	for _, budget := range []int64{0, 100} {
+		sorted, err := Sort(s, func(a, b []byte) bool { return bytes.Compare(csvName(a), csvName(b)) < 0 }, SortOptions{MemoryBudget: budget})
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects := readStream(t, sorted)
+		if len(objects) != 25 || !sort.SliceIsSorted(objects, func(i, j int) bool {
+			return bytes.Compare(csvName([]byte(objects[i])), csvName([]byte(objects[j]))) < 0
+		}) {
+			t.Fatal(budget, objects)
+		}
+	}
+
+	for _, mode := range []string{DedupMemory, DedupSpill} {
+		deduped, dropped, err := Dedup(s, DedupOptions{Mode: mode, KeyFunc: csvName, MemoryBudget: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(readStream(t, deduped)); n != 3 || dropped != 22 {
+			t.Fatal(mode, n, dropped)
+		}
+	}
+
+	for _, strategy := range []string{PartitionHash, PartitionRange, PartitionRoundRobin} {
+		partitions, err := Partition(s, 3, csvName, strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, p := range partitions {
+			n += len(readStream(t, p))
+		}
+		if n != 25 {
+			t.Fatal(strategy, n)
+		}
+	}
+
+	for _, budget := range []int64{0, 50} {
+		joined, err := Join(s, s, csvName, csvName, JoinInner, func(l, r []byte) ([]byte, error) {
+			return []byte(string(l) + "|" + string(r)), nil
+		}, JoinOptions{MemoryBudget: budget})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The names n0, n1, and n2 are shared by 9, 8, and 8 records.
+		if n := len(readStream(t, joined)); n != 9*9+8*8+8*8 {
+			t.Fatal(budget, n)
+		}
+	}
+
+	for _, budget := range []int64{0, 100} {
+		it, err := s.Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		grouped, err := GroupBy(it, csvName, CountReducer(), GroupByOptions{MemoryBudget: budget, TempDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(readStream(t, grouped)); n != 3 {
+			t.Fatal(budget, n)
+		}
+	}
+}
+
+func TestColumnarIndex(t *testing.T) {
+	s, err := New("snappy", "big", 10, "columnar", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Extractor = csvExtractor{}
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddIndex("name", csvName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		err := s.Append([]byte(csvRecord(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := s.GetByIndex("name", []byte("n1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 8 || string(objects[0]) != csvRecord(1) {
+		t.Fatal(len(objects), err)
+	}
+}
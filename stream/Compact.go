@@ -0,0 +1,384 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Compact rewrites runs of adjacent small blocks into blocks with at most targetObjects objects and targetBytes compressed bytes.
+// If targetObjects or targetBytes is zero, then that limit is ignored.  Blocks that already meet a target are left as is.
+// The rewritten blocks are swapped into Blocks in one step, with new identifiers, and the old blocks are removed.
+// Iterators opened before the swap keep reading the old blocks, which are removed once those iterators are closed.
+// Cursors and follow iterators that point to an old block resume at the same object in the block that replaced it.
+// If blocks are evicted during the compaction, then the rewritten blocks that include them are discarded and the other blocks they replace are kept as is.
+// The index entries for the rewritten blocks are built before the swap, so writers are not blocked while they are built.
+func (s *Stream) Compact(targetObjects int, targetBytes int64) error {
+
+	if targetObjects <= 0 && targetBytes <= 0 {
+		return errors.New("Invalid compaction targets.  Need a positive target number of objects or bytes.")
+	}
+
+	s.mutex.Lock()
+	blocks := s.Blocks
+	rewrites := s.rewrites
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	defer s.release(blocks)
+
+	counts := map[Block]int{}
+	groups := make([][]Block, 0)
+	group := make([]Block, 0)
+	objects := 0
+	size := int64(0)
+	for i, block := range blocks {
+		count, err := countObjects(block)
+		if err != nil {
+			return errors.Wrap(err, "Error counting objects in block "+fmt.Sprint(i))
+		}
+		counts[block] = count
+		blockSize, err := block.Size()
+		if err != nil {
+			return errors.Wrap(err, "Error calculating size for block "+fmt.Sprint(i))
+		}
+		fits := (targetObjects <= 0 || objects+count <= targetObjects) && (targetBytes <= 0 || size+blockSize <= targetBytes)
+		// Blocks of different time windows are never rewritten together.
+		if len(group) > 0 {
+			start, _ := block.GetWindow()
+			groupStart, _ := group[0].GetWindow()
+			fits = fits && start.Equal(groupStart)
+		}
+		if len(group) > 0 && !fits {
+			groups = append(groups, group)
+			group = make([]Block, 0)
+			objects = 0
+			size = 0
+		}
+		group = append(group, block)
+		objects += count
+		size += blockSize
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	replacements := make([]Block, 0, len(groups))
+	created := make([]Block, 0)
+	for _, group := range groups {
+		if len(group) == 1 {
+			replacements = append(replacements, group[0])
+			continue
+		}
+		block, err := s.rewrite(group, s.Algorithm, s.BlockType)
+		if err != nil {
+			for _, block := range created {
+				block.Remove()
+			}
+			return errors.Wrap(err, "Error rewriting blocks")
+		}
+		// The rewritten block is as old as the newest of its blocks, so it is not evicted by age before its data.
+		block.SetCreated(group[len(group)-1].GetCreated())
+		block.SetWindow(group[0].GetWindow())
+		replacements = append(replacements, block)
+		created = append(created, block)
+	}
+
+	if len(created) == 0 {
+		return nil
+	}
+
+	// Reserve the identifiers of the rewritten blocks, so the index entries pointing to them are built before the swap.
+	s.mutex.Lock()
+	for _, block := range created {
+		block.SetID(s.nextBlockID)
+		s.nextBlockID += 1
+	}
+	indexes := make(map[string]*Index, len(s.Indexes))
+	for name, idx := range s.Indexes {
+		indexes[name] = idx
+	}
+	s.mutex.Unlock()
+
+	entries := make(map[*Index][]indexBlock, len(indexes))
+	for name, idx := range indexes {
+		built, err := idx.entries(created)
+		if err != nil {
+			for _, block := range created {
+				block.Remove()
+			}
+			for _, built := range entries {
+				removeIndexBlocks(built)
+			}
+			return errors.Wrap(err, "Error building index \""+name+"\"")
+		}
+		entries[idx] = built
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	skipped, err := s.swap(blocks, rewrites, groups, replacements)
+	if err != nil {
+		for _, built := range entries {
+			removeIndexBlocks(built)
+		}
+		return err
+	}
+
+	// The groups with blocks evicted during the compaction were not replaced, so their index entries are removed.
+	old := make([]Block, 0)
+	swapped := make([]Block, 0, len(created))
+	dropped := map[int]bool{}
+	for i, group := range groups {
+		if replacements[i] == group[0] {
+			continue
+		}
+		if i < skipped {
+			dropped[replacements[i].GetID()] = true
+			continue
+		}
+		old = append(old, group...)
+		swapped = append(swapped, replacements[i])
+	}
+	for name, idx := range s.Indexes {
+		built, ok := entries[idx]
+		if !ok {
+			// The index was added during the compaction, so its entries are built while holding the mutex.
+			built, err = idx.entries(swapped)
+			if err != nil {
+				return errors.Wrap(err, "Error building index \""+name+"\"")
+			}
+		}
+		kept := make([]indexBlock, 0, len(built))
+		for _, ib := range built {
+			if dropped[ib.source] {
+				ib.block.Remove()
+				continue
+			}
+			kept = append(kept, ib)
+		}
+		idx.replace(old, kept)
+	}
+	for i, group := range groups[skipped:] {
+		replacement := replacements[skipped+i]
+		if replacement == group[0] {
+			continue
+		}
+		offset := 0
+		for _, block := range group {
+			s.move(block.GetID(), Cursor{BlockID: replacement.GetID(), Offset: offset})
+			offset += counts[block]
+		}
+	}
+	return nil
+}
+
+// move records that the objects of the block with the given identifier now begin at the cursor.
+// Cursors that pointed to the block are moved too, so resolving a moved block never follows a chain.
+// The blocks moved into each block are indexed by movedFrom, so a move only visits the cursors that pointed to the block.
+// The caller must hold the stream's mutex.
+func (s *Stream) move(id int, c Cursor) {
+	if s.moved == nil {
+		s.moved = map[int]Cursor{}
+		s.movedFrom = map[int][]int{}
+	}
+	sources := s.movedFrom[id]
+	for _, k := range sources {
+		s.moved[k] = Cursor{BlockID: c.BlockID, Offset: c.Offset + s.moved[k].Offset}
+	}
+	delete(s.movedFrom, id)
+	s.moved[id] = c
+	s.movedFrom[c.BlockID] = append(append(s.movedFrom[c.BlockID], sources...), id)
+}
+
+// unmove forgets the cursors moved into the blocks with the given identifiers.  The caller must hold the stream's mutex.
+func (s *Stream) unmove(ids []int) {
+	for _, id := range ids {
+		for _, k := range s.movedFrom[id] {
+			delete(s.moved, k)
+		}
+		delete(s.movedFrom, id)
+	}
+}
+
+// resolve returns the index in Blocks of the cursor's block, and the offset of the cursor's object in that block,
+// following the cursor to the replacement block if its block was compacted.
+// Returns false if the block no longer exists in the stream.
+// The caller must hold the stream's mutex.
+func (s *Stream) resolve(c Cursor) (int, int, bool) {
+	if m, ok := s.moved[c.BlockID]; ok {
+		c = Cursor{BlockID: m.BlockID, Offset: m.Offset + c.Offset}
+	}
+	for i, block := range s.Blocks {
+		if block.GetID() == c.BlockID {
+			return i, c.Offset, true
+		}
+	}
+	return 0, 0, false
+}
+
+// swap replaces the groups of the snapshot of blocks at the beginning of Blocks with their replacements and retires the old blocks.
+// Each group is a run of adjacent blocks of the snapshot, and is replaced by the block at the same position in replacements.
+// A group whose replacement is its only block is kept as is.
+// Blocks evicted from the beginning of the snapshot since it was taken are not replaced.
+// The groups with an evicted block are kept as is, and their replacements are removed.
+// Returns the number of groups that were not replaced, which are always the first groups.
+// The caller assigns the identifiers of the created blocks and updates the indexes.
+// If Blocks were rewritten by another operation since the snapshot was taken, then the created blocks are removed and returns an error.
+// The caller must hold the stream's mutex.
+func (s *Stream) swap(snapshot []Block, rewrites int, groups [][]Block, replacements []Block) (int, error) {
+
+	evicted, ok := s.evictedFrom(snapshot)
+	if !ok || s.rewrites != rewrites {
+		for i, group := range groups {
+			if replacements[i] != group[0] {
+				replacements[i].Remove()
+			}
+		}
+		return 0, errors.New("Error swapping blocks.  Blocks were changed by another operation.")
+	}
+
+	skipped := 0
+	for n := 0; n < evicted; skipped++ {
+		n += len(groups[skipped])
+	}
+
+	blocks := make([]Block, 0, len(replacements)+len(s.Blocks)-len(snapshot)+evicted)
+	old := make([]Block, 0)
+	created := make([]Block, 0)
+	n := 0
+	for i, group := range groups {
+		if i < skipped {
+			// The blocks of the group that were not evicted are kept.
+			for _, block := range group {
+				if n >= evicted {
+					blocks = append(blocks, block)
+				}
+				n += 1
+			}
+			if replacements[i] != group[0] {
+				replacements[i].Remove()
+			}
+			continue
+		}
+		blocks = append(blocks, replacements[i])
+		if replacements[i] != group[0] {
+			old = append(old, group...)
+			created = append(created, replacements[i])
+		}
+	}
+	blocks = append(blocks, s.Blocks[len(snapshot)-evicted:]...)
+	s.Blocks = blocks
+	s.rewrites += 1
+	s.untrack(old)
+	s.track(created)
+	s.retire(old)
+	s.notify()
+	return skipped, nil
+}
+
+// evictedFrom returns the number of blocks evicted from the beginning of the snapshot of blocks since it was taken,
+// and false if Blocks does not begin with the rest of the snapshot.  The caller must hold the stream's mutex.
+func (s *Stream) evictedFrom(snapshot []Block) (int, bool) {
+	evicted := len(snapshot)
+	if len(s.Blocks) > 0 {
+		for i, block := range snapshot {
+			if block == s.Blocks[0] {
+				evicted = i
+				break
+			}
+		}
+	}
+	return evicted, hasPrefix(s.Blocks, snapshot[evicted:])
+}
+
+// hasPrefix returns true if blocks begins with the prefix.
+func hasPrefix(blocks []Block, prefix []Block) bool {
+	if len(blocks) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if blocks[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rewrite returns a new block with the objects of the given blocks, using the given algorithm and block type.
+func (s *Stream) rewrite(blocks []Block, algorithm string, blockType string) (Block, error) {
+	w, err := New(algorithm, s.Endianness(), s.BlockSize, blockType, s.TempDir)
+	if err != nil {
+		return nil, err
+	}
+	w.KeyFunc = s.KeyFunc
+	w.BloomFilterRate = s.BloomFilterRate
+	w.Extractor = s.Extractor
+	w.Transform = s.Transform
+	w.Store = s.Store
+	err = w.Init()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error initializing writer")
+	}
+	for i, block := range blocks {
+		it, err := block.Iterator()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(i))
+		}
+		for {
+			b, err := it.Next()
+			if err != nil {
+				it.Close()
+				if err == io.EOF {
+					break
+				}
+				w.Remove()
+				return nil, errors.Wrap(err, "Error reading block "+fmt.Sprint(i))
+			}
+			_, err = w.WriteRecord(b)
+			if err != nil {
+				it.Close()
+				w.Remove()
+				return nil, errors.Wrap(err, "Error writing object")
+			}
+		}
+	}
+	err = w.Rotate()
+	if err != nil {
+		w.Remove()
+		return nil, errors.Wrap(err, "Error sealing block")
+	}
+	return w.Blocks[0], nil
+}
+
+// countObjects returns the number of objects in the block, reading the block if the count is unknown.
+func countObjects(block Block) (int, error) {
+	if count := block.GetCount(); count >= 0 {
+		return count, nil
+	}
+	it, err := block.Iterator()
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	count := 0
+	for {
+		_, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, err
+		}
+		count += 1
+	}
+}
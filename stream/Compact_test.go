@@ -0,0 +1,154 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	for _, blockType := range []string{"memory", "file"} {
+		s := newTestStream(t, "snappy", blockType, 3)
+		appendRecords(t, s, 0, 100)
+		s.Close()
+		before, err := s.Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		before.Next()
+		n := len(s.Blocks)
+		err = s.Compact(20, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Blocks) >= n {
+			t.Fatalf("expected fewer than %d blocks but found %d", n, len(s.Blocks))
+		}
+		// The iterator opened before compaction keeps reading the old blocks.
+		expectRecords(t, readAll(t, before), 1, 100)
+		expectRecords(t, readStream(t, s), 0, 100)
+		b, err := s.Get(57)
+		if err != nil || string(b) != testRecord(57) {
+			t.Fatal(string(b), err)
+		}
+	}
+}
+
+func TestCompactCursor(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 3)
+	appendRecords(t, s, 0, 30)
+	s.Close()
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		it.Next()
+	}
+	c := it.Cursor()
+	it.Close()
+	err = s.Compact(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Compact(30, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Blocks) != 1 {
+		t.Fatalf("expected 1 block but found %d", len(s.Blocks))
+	}
+	resumed, err := s.IteratorFrom(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, readAll(t, resumed), 7, 30)
+}
+
+func TestCompactManyBlocks(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 1)
+	appendRecords(t, s, 0, 5000)
+	c := Cursor{BlockID: s.Blocks[4321].GetID(), Offset: 0}
+	err := s.Compact(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Compact(5000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every block rewritten by either compaction is moved into the single block left.
+	if len(s.Blocks) != 1 || len(s.moved) != 5050 || len(s.movedFrom) != 1 {
+		t.Fatal(len(s.Blocks), len(s.moved), len(s.movedFrom))
+	}
+	resumed, err := s.IteratorFrom(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, readAll(t, resumed), 4321, 5000)
+	// Evicting the block forgets the cursors moved into it.
+	appendRecords(t, s, 5000, 5001)
+	s.MaxRecords = 1
+	err = s.Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.moved) != 0 || len(s.movedFrom) != 0 {
+		t.Fatal(len(s.moved), len(s.movedFrom))
+	}
+}
+
+func TestCompactFollowIterator(t *testing.T) {
+	for _, blockType := range []string{"memory", "file"} {
+		s := newTestStream(t, "snappy", blockType, 3)
+		appendRecords(t, s, 0, 30)
+		it := s.Follow(context.Background())
+		objects := make([]string, 0)
+		for i := 0; i < 5; i++ {
+			b, err := it.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			objects = append(objects, string(b))
+		}
+		err := s.Compact(100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendRecords(t, s, 30, 40)
+		s.Close()
+		objects = append(objects, readAll(t, it)...)
+		expectRecords(t, objects, 0, 40)
+	}
+}
+
+func TestCompactFileDescriptors(t *testing.T) {
+	before, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open file descriptors are not listed in /proc/self/fd")
+	}
+	s := newTestStream(t, "snappy", "file", 2)
+	appendRecords(t, s, 0, 200)
+	s.Close()
+	for i := 0; i < 3; i++ {
+		err := s.Compact(0, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) > len(before)+10 {
+		t.Fatalf("expected about %d open files but found %d", len(before), len(after))
+	}
+	expectRecords(t, readStream(t, s), 0, 200)
+}
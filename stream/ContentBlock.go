@@ -0,0 +1,109 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ContentBlock is a block whose compressed bytes are kept in a content-addressed BlockStore.
+// Identical blocks, in the same stream or in different streams, share one copy in the store.
+type ContentBlock struct {
+	AbstractBlock
+	Store  BlockStore `xml:"-" json:"-"`
+	Digest string     `xml:"-" json:"-"` // the hex-encoded SHA-256 digest of the compressed bytes
+	Length int64      `xml:"-" json:"-"` // the number of compressed bytes
+}
+
+// memoryBlock returns a MemoryBlock over the bytes in the store for reading.
+func (cb *ContentBlock) memoryBlock() (*MemoryBlock, error) {
+	if cb.Digest == "" {
+		return nil, errors.New("Error reading content block.  Block is not initialized or was removed.")
+	}
+	b, err := cb.Store.Get(cb.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryBlock{AbstractBlock: cb.AbstractBlock, Bytes: b}, nil
+}
+
+// Size returns the number of compressed bytes as an int64, without reading the store.
+func (cb *ContentBlock) Size() (int64, error) {
+	if cb.Digest == "" {
+		return 0, errors.New("Error calculating size of content block.  Block is not initialized or was removed.")
+	}
+	return cb.Length, nil
+}
+
+// Reader returns a *Reader for reading the compressed bytes, and an error if any.
+func (cb *ContentBlock) Reader() (*Reader, error) {
+	mb, err := cb.memoryBlock()
+	if err != nil {
+		return nil, err
+	}
+	return mb.Reader()
+}
+
+// Iterator returns a BlockIterator for iterating through the bytes, and an error if any.
+func (cb *ContentBlock) Iterator() (*BlockIterator, error) {
+	mb, err := cb.memoryBlock()
+	if err != nil {
+		return &BlockIterator{}, errors.Wrap(err, "Error creating iterator")
+	}
+	return mb.Iterator()
+}
+
+// Get returns the bytes for an object at an arbitrary position, and an error if any.
+func (cb *ContentBlock) Get(position int) ([]byte, error) {
+	mb, err := cb.memoryBlock()
+	if err != nil {
+		return make([]byte, 0), errors.Wrap(err, "Error getting bytes at position "+fmt.Sprint(position)+" in block")
+	}
+	return mb.Get(position)
+}
+
+// Init puts the compressed bytes in the store and keeps their digest.
+func (cb *ContentBlock) Init(b []byte) error {
+	if cb.Store == nil {
+		return errors.New("Error initializing content block.  Store is nil.")
+	}
+	digest, err := cb.Store.Put(b)
+	if err != nil {
+		return errors.Wrap(err, "Error putting block in store")
+	}
+	cb.Digest = digest
+	cb.Length = int64(len(b))
+	return nil
+}
+
+// Remove releases the block's reference in the store, which deletes the bytes once no block references them.
+func (cb *ContentBlock) Remove() error {
+	if cb.Digest == "" {
+		return nil
+	}
+	digest := cb.Digest
+	cb.Digest = ""
+	return cb.Store.Release(digest)
+}
+
+// NewContentBlock returns a new ContentBlock that keeps its bytes in the store.
+// Algorithm can be snappy, gzip, or none.
+func NewContentBlock(algorithm string, bigEndian bool, store BlockStore) *ContentBlock {
+	return &ContentBlock{
+		AbstractBlock: AbstractBlock{
+			Count:     -1,
+			Algorithm: algorithm,
+			BigEndian: bigEndian,
+		},
+		Store: store,
+	}
+}
@@ -0,0 +1,54 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrBlockNotFound is returned when a cursor points to a block that no longer exists in the stream.
+var ErrBlockNotFound = errors.New("block not found")
+
+// EndCursor is the cursor of an iterator that has no current block, such as an iterator over no blocks.
+// Passing it to Stream.IteratorFrom returns an error wrapping ErrBlockNotFound.
+var EndCursor = Cursor{BlockID: -1, Offset: 0}
+
+// Cursor is a position in a stream made of a block identifier and a record offset within that block.
+// A cursor can be marshalled and later passed to Stream.IteratorFrom to resume iteration.
+type Cursor struct {
+	BlockID int `xml:"block" json:"block"`   // the identifier of the block
+	Offset  int `xml:"offset" json:"offset"` // the number of records already read from the block
+}
+
+// MarshalBinary encodes the cursor as 16 bytes, and returns an error if any.
+func (c Cursor) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[0:8], uint64(c.BlockID))
+	binary.BigEndian.PutUint64(b[8:16], uint64(c.Offset))
+	return b, nil
+}
+
+// UnmarshalBinary decodes a cursor encoded with MarshalBinary, and returns an error if any.
+func (c *Cursor) UnmarshalBinary(b []byte) error {
+	if len(b) != 16 {
+		return errors.New("Invalid cursor length " + fmt.Sprint(len(b)) + ".  Expecting 16 bytes.")
+	}
+	c.BlockID = int(binary.BigEndian.Uint64(b[0:8]))
+	c.Offset = int(binary.BigEndian.Uint64(b[8:16]))
+	return nil
+}
+
+// String returns a string representation of the cursor.
+func (c Cursor) String() string {
+	return fmt.Sprint(c.BlockID) + ":" + fmt.Sprint(c.Offset)
+}
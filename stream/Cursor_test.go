@@ -0,0 +1,88 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+func TestCursorMarshalBinary(t *testing.T) {
+	c := Cursor{BlockID: 3, Offset: 42}
+	b, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d Cursor
+	err = d.UnmarshalBinary(b)
+	if err != nil || d != c {
+		t.Fatal(d, err)
+	}
+	if d.UnmarshalBinary(b[:10]) == nil {
+		t.Fatal("expected error for short cursor")
+	}
+}
+
+func TestIteratorFrom(t *testing.T) {
+	for _, blockType := range []string{"memory", "file"} {
+		s := newTestStream(t, "snappy", blockType, 10)
+		appendRecords(t, s, 0, 25)
+		s.Close()
+
+		it, err := s.Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 13; i++ {
+			_, err := it.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		c := it.Cursor()
+		it.Close()
+		if c.BlockID != s.Blocks[1].GetID() || c.Offset != 3 {
+			t.Fatal(c)
+		}
+
+		resumed, err := s.IteratorFrom(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectRecords(t, readAll(t, resumed), 13, 25)
+
+		_, err = s.IteratorFrom(Cursor{BlockID: 99})
+		if errors.Cause(err) != ErrBlockNotFound {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamIteratorCursorWithoutBlock(t *testing.T) {
+	if c := (&StreamIterator{}).Cursor(); c != EndCursor {
+		t.Fatal(c)
+	}
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 5)
+	s.Close()
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, it)
+	if c := it.Cursor(); c.BlockID != s.Blocks[0].GetID() || c.Offset != 5 {
+		t.Fatal(c)
+	}
+	_, err = s.IteratorFrom(EndCursor)
+	if errors.Cause(err) != ErrBlockNotFound {
+		t.Fatal(err)
+	}
+}
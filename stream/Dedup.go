@@ -0,0 +1,247 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	DedupMemory      = "memory"      // exact deduplication using an in-memory set of keys
+	DedupSpill       = "spill"       // exact deduplication using an external sort by key
+	DedupApproximate = "approximate" // approximate deduplication using a bounded bloom filter
+)
+
+// DedupOptions are the options for deduplication.
+type DedupOptions struct {
+	Mode              string                // the mode: memory, spill, or approximate.  Defaults to memory.
+	KeyFunc           func(b []byte) []byte // returns the key of an object.  Defaults to ContentHash.
+	ExpectedItems     int                   // the number of keys the bloom filter is sized for in approximate mode.  Defaults to 1,000,000.
+	FalsePositiveRate float64               // the false positive rate of the bloom filter in approximate mode.  Defaults to 0.001.
+	MemoryBudget      int64                 // the memory budget for the external sort in spill mode.  Defaults to DefaultMemoryBudget.
+	TempDir           string                // the directory for sorted runs in spill mode.  Defaults to the source stream's TempDir.
+}
+
+// ContentHash returns the 128-bit FNV-1a hash of the bytes.
+func ContentHash(b []byte) []byte {
+	h := fnv.New128a()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// Deduplicator tracks the keys of the objects it has seen and counts the duplicates it dropped.
+// A Deduplicator can be assigned to Stream.Deduplicator to drop duplicates as they are written.
+// A Deduplicator supports the memory and approximate modes.
+type Deduplicator struct {
+	Options DedupOptions `xml:"-" json:"-"`
+	Dropped int64        `xml:"dropped" json:"dropped"` // the number of duplicates dropped
+	seen    map[string]struct{}
+	filter  *BloomFilter
+}
+
+// NewDeduplicator returns a new Deduplicator, and an error if any.
+func NewDeduplicator(options DedupOptions) (*Deduplicator, error) {
+	if options.KeyFunc == nil {
+		options.KeyFunc = ContentHash
+	}
+	d := &Deduplicator{Options: options}
+	switch options.Mode {
+	case "", DedupMemory:
+		d.Options.Mode = DedupMemory
+		d.seen = map[string]struct{}{}
+	case DedupApproximate:
+		n := options.ExpectedItems
+		if n <= 0 {
+			n = 1000000
+		}
+		p := options.FalsePositiveRate
+		if p <= 0 {
+			p = 0.001
+		}
+		d.filter = NewBloomFilter(n, p)
+	case DedupSpill:
+		return nil, errors.New("Spill mode requires a complete stream.  Use Dedup instead.")
+	default:
+		return nil, errors.New("Unknown deduplication mode \"" + options.Mode + "\"")
+	}
+	return d, nil
+}
+
+// Add adds the key of the object to the set of seen keys.
+// Returns true if the object is new, and false if it is a duplicate.
+// In approximate mode, a new object may be reported as a duplicate at the filter's false positive rate.
+func (d *Deduplicator) Add(b []byte) bool {
+	key := d.Options.KeyFunc(b)
+	if d.contains(key) {
+		d.Dropped += 1
+		return false
+	}
+	d.insert(key)
+	return true
+}
+
+// contains returns true if the key has been seen.  Does not change the set of seen keys.
+func (d *Deduplicator) contains(key []byte) bool {
+	if d.filter != nil {
+		return d.filter.MayContain(key)
+	}
+	_, ok := d.seen[string(key)]
+	return ok
+}
+
+// insert adds the key to the set of seen keys.
+func (d *Deduplicator) insert(key []byte) {
+	if d.filter != nil {
+		d.filter.Add(key)
+		return
+	}
+	d.seen[string(key)] = struct{}{}
+}
+
+// DedupIterator is an iterator that skips objects its Deduplicator has already seen.
+type DedupIterator struct {
+	Iterator     Iterator      `xml:"-" json:"-"`
+	Deduplicator *Deduplicator `xml:"-" json:"-"`
+}
+
+// NewDedupIterator returns a new DedupIterator wrapping the iterator.
+func NewDedupIterator(it Iterator, d *Deduplicator) *DedupIterator {
+	return &DedupIterator{Iterator: it, Deduplicator: d}
+}
+
+// Next returns the next object that is not a duplicate, and an error if any.
+func (it *DedupIterator) Next() ([]byte, error) {
+	for {
+		b, err := it.Iterator.Next()
+		if err != nil {
+			return b, err
+		}
+		if it.Deduplicator.Add(b) {
+			return b, nil
+		}
+	}
+}
+
+// Close closes the underlying iterator.
+func (it *DedupIterator) Close() error {
+	return it.Iterator.Close()
+}
+
+// Dedup returns a new closed stream with the duplicate objects of the source stream dropped,
+// and the number of duplicates dropped.
+// In memory and approximate modes, the first occurrence of each object is kept in the original order.
+// In spill mode, the objects are sorted by key, so the new stream is in key order.
+func Dedup(src *Stream, options DedupOptions) (*Stream, int64, error) {
+
+	if options.KeyFunc == nil {
+		options.KeyFunc = ContentHash
+	}
+
+	out, err := src.derive(src.BlockType, src.TempDir)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Error creating output stream")
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			out.Close()
+			out.Remove()
+		}
+	}()
+
+	var it Iterator
+	var d *Deduplicator
+	if options.Mode == DedupSpill {
+		keyFunc := options.KeyFunc
+		sorted, err := Sort(src, func(a, b []byte) bool {
+			return bytes.Compare(keyFunc(a), keyFunc(b)) < 0
+		}, SortOptions{MemoryBudget: options.MemoryBudget, TempDir: options.TempDir})
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "Error sorting stream by key")
+		}
+		defer sorted.Remove()
+		si, err := sorted.Iterator()
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "Error creating iterator for sorted stream")
+		}
+		d = &Deduplicator{Options: options}
+		it = &sortedDedupIterator{Iterator: si, Deduplicator: d}
+	} else {
+		d, err = NewDeduplicator(options)
+		if err != nil {
+			return nil, 0, err
+		}
+		si, err := src.open()
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "Error creating iterator for source stream")
+		}
+		if si != nil {
+			it = NewDedupIterator(si, d)
+		}
+	}
+
+	if it != nil {
+		defer it.Close()
+		for {
+			b, err := it.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, d.Dropped, errors.Wrap(err, "Error reading from source stream")
+			}
+			err = out.Append(b)
+			if err != nil {
+				return nil, d.Dropped, errors.Wrap(err, "Error writing to output stream")
+			}
+		}
+	}
+
+	err = out.Close()
+	if err != nil {
+		return nil, d.Dropped, errors.Wrap(err, "Error closing output stream")
+	}
+
+	succeeded = true
+	return out, d.Dropped, nil
+}
+
+// sortedDedupIterator is an iterator that skips objects with the same key as the previous object.
+type sortedDedupIterator struct {
+	Iterator     Iterator
+	Deduplicator *Deduplicator
+	previous     []byte
+	started      bool
+}
+
+func (it *sortedDedupIterator) Next() ([]byte, error) {
+	for {
+		b, err := it.Iterator.Next()
+		if err != nil {
+			return b, err
+		}
+		key := it.Deduplicator.Options.KeyFunc(b)
+		if it.started && bytes.Equal(key, it.previous) {
+			it.Deduplicator.Dropped += 1
+			continue
+		}
+		it.started = true
+		it.previous = key
+		return b, nil
+	}
+}
+
+func (it *sortedDedupIterator) Close() error {
+	return it.Iterator.Close()
+}
@@ -0,0 +1,109 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 7)
+	for i := 0; i < 100; i++ {
+		err := s.Append([]byte(fmt.Sprintf("v%02d", i%30)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	for _, mode := range []string{DedupMemory, DedupSpill, DedupApproximate} {
+		out, dropped, err := Dedup(s, DedupOptions{Mode: mode, MemoryBudget: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects := readStream(t, out)
+		if len(objects) != 30 || dropped != 70 {
+			t.Fatal(mode, len(objects), dropped)
+		}
+		seen := map[string]bool{}
+		for _, object := range objects {
+			if seen[object] {
+				t.Fatalf("%s: duplicate object %q", mode, object)
+			}
+			seen[object] = true
+		}
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	d, err := NewDeduplicator(DedupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestStream(t, "snappy", "memory", 7)
+	s.Deduplicator = d
+	for i := 0; i < 10; i++ {
+		n, err := s.WriteRecord([]byte{byte(i % 3)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (n == 0) != (i >= 3) {
+			t.Fatalf("expected object %d to be dropped only if it is a duplicate", i)
+		}
+	}
+	s.Close()
+	if n := len(readStream(t, s)); n != 3 || d.Dropped != 7 {
+		t.Fatal(n, d.Dropped)
+	}
+}
+
+func TestDeduplicatorFailedWrite(t *testing.T) {
+	for _, mode := range []string{DedupMemory, DedupApproximate} {
+		d, err := NewDeduplicator(DedupOptions{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newTestStream(t, "snappy", "memory", 7)
+		s.Deduplicator = d
+		writer := s.Writer
+		s.Writer = failingWriter{}
+		_, err = s.WriteRecord([]byte("a"))
+		if err == nil {
+			t.Fatal("expected an error from the writer")
+		}
+		s.Writer = writer
+		// The object was never written, so the retry is not a duplicate.
+		n, err := s.WriteRecord([]byte("a"))
+		if err != nil || n == 0 || d.Dropped != 0 {
+			t.Fatal(mode, n, err, d.Dropped)
+		}
+		s.Close()
+		if n := len(readStream(t, s)); n != 1 {
+			t.Fatalf("%s: expected 1 object but found %d", mode, n)
+		}
+	}
+}
+
+func TestDedupRemovesOutputOnError(t *testing.T) {
+	s := newTestStream(t, "snappy", "file", 10)
+	appendRecords(t, s, 0, 50)
+	s.Close()
+	// The last block of objects is removed, so reading the source fails after the new stream has sealed blocks.
+	err := s.Blocks[4].Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := countFiles(t, s.TempDir)
+	_, _, err = Dedup(s, DedupOptions{})
+	if err == nil {
+		t.Fatal("expected an error reading the source stream")
+	}
+	if after := countFiles(t, s.TempDir); after != before {
+		t.Fatalf("expected the new stream to be removed, but the files grew from %d to %d", before, after)
+	}
+}
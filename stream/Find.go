@@ -0,0 +1,120 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrOutOfOrder is returned when an object is written to a sorted stream out of order.
+var ErrOutOfOrder = errors.New("object out of order")
+
+// ErrKeyNotFound is returned when no object in the stream has the given key.
+var ErrKeyNotFound = errors.New("key not found")
+
+// Find returns the first object in a sorted stream with the given key, and an error if any.
+// The keys are returned by KeyFunc, or are the objects themselves if KeyFunc is nil, and are compared with cmp.
+// If cmp is nil, then the stream's Compare function is used.
+// Find runs a binary search over the first key of each block, taken from the block's statistics when available,
+// and then scans the candidate blocks only until it passes the key.
+// If no object has the key, then returns an error wrapping ErrKeyNotFound.
+func (s *Stream) Find(key []byte, cmp func(a []byte, b []byte) int) ([]byte, error) {
+
+	if cmp == nil {
+		cmp = s.compare
+	}
+
+	s.mutex.Lock()
+	blocks := s.Blocks
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	defer s.release(blocks)
+
+	var searchErr error
+	i := sort.Search(len(blocks), func(i int) bool {
+		first, ok, err := s.firstKey(blocks[i])
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return !ok || cmp(first, key) >= 0
+	})
+	if searchErr != nil {
+		return make([]byte, 0), errors.Wrap(searchErr, "Error reading first key of block")
+	}
+
+	// The first object with the key may be at the end of the previous block.
+	if i > 0 {
+		i -= 1
+	}
+
+	for ; i < len(blocks); i++ {
+		b, found, passed, err := s.findInBlock(blocks[i], key, cmp)
+		if err != nil {
+			return make([]byte, 0), errors.Wrap(err, "Error searching block "+fmt.Sprint(blocks[i].GetID()))
+		}
+		if found {
+			return b, nil
+		}
+		if passed {
+			break
+		}
+	}
+
+	return make([]byte, 0), errors.Wrap(ErrKeyNotFound, "Error finding key")
+}
+
+// firstKey returns the key of the first object in the block, and false if the block is empty.
+func (s *Stream) firstKey(block Block) ([]byte, bool, error) {
+	if stats := block.GetStats(); stats != nil && stats.NullCount == 0 {
+		return stats.MinKey, stats.Count > 0, nil
+	}
+	if block.GetCount() == 0 {
+		return nil, false, nil
+	}
+	b, err := block.Get(0)
+	if err != nil {
+		if errors.Cause(err) == io.EOF {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return s.key(b), true, nil
+}
+
+// findInBlock scans the block for the first object with the key.
+// Returns the object and true if found, or true for passed if the scan stopped at a greater key.
+func (s *Stream) findInBlock(block Block, key []byte, cmp func(a []byte, b []byte) int) ([]byte, bool, bool, error) {
+	it, err := block.Iterator()
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer it.Close()
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, false, false, nil
+			}
+			return nil, false, false, err
+		}
+		c := cmp(s.key(b), key)
+		if c == 0 {
+			return b, true, false, nil
+		}
+		if c > 0 {
+			return nil, false, true, nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+func TestFind(t *testing.T) {
+	for _, keyed := range []bool{true, false} {
+		s, err := New("snappy", "little", 10, "memory", t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyed {
+			s.KeyFunc = func(b []byte) []byte { return b[:3] }
+		}
+		s.Sorted = true
+		err = s.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			err := s.Append([]byte(fmt.Sprintf("%03d-x", i*2)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = s.WriteRecord([]byte("001-y"))
+		if errors.Cause(err) != ErrOutOfOrder {
+			t.Fatal(err)
+		}
+		s.Close()
+		key := "084"
+		if !keyed {
+			key = "084-x"
+		}
+		b, err := s.Find([]byte(key), nil)
+		if err != nil || string(b) != "084-x" {
+			t.Fatal(string(b), err)
+		}
+		for _, missing := range []string{"001", "085", "999"} {
+			if !keyed {
+				missing += "-y"
+			}
+			_, err = s.Find([]byte(missing), nil)
+			if errors.Cause(err) != ErrKeyNotFound {
+				t.Fatalf("expected ErrKeyNotFound for %q but found %v", missing, err)
+			}
+		}
+	}
+}
+
+func TestSortedFailedWrite(t *testing.T) {
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Sorted = true
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := s.Writer
+	s.Writer = failingWriter{}
+	_, err = s.WriteRecord([]byte("b"))
+	if err == nil {
+		t.Fatal("expected an error from the writer")
+	}
+	s.Writer = writer
+	// The object "b" was never written, so "a" is still in order.
+	_, err = s.WriteRecord([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.WriteRecord([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if objects := fmt.Sprint(readStream(t, s)); objects != "[a b]" {
+		t.Fatal(objects)
+	}
+}
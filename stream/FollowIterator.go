@@ -0,0 +1,319 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+import (
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+)
+
+// FollowIterator is an iterator that follows a stream as it is written, similar to "tail -f".
+// When the iterator reaches the end of the sealed blocks, it reads records flushed to the stream's buffer
+// and then waits for the stream to change instead of returning io.EOF.
+// Next returns io.EOF once the stream is closed and all records have been read,
+// or the context's error if the context is cancelled.
+// If the block being followed is rewritten by Compact, then the iterator resumes at the same object in the block that replaced it.
+// If the block being followed is evicted or removed from the stream, then the iterator skips ahead to the oldest block left in the stream.
+type FollowIterator struct {
+	Stream        *Stream         `xml:"-" json:"-"`
+	Context       context.Context `xml:"-" json:"-"`
+	BlockID       int             `xml:"-" json:"-"` // the identifier of the current block, or of the block the buffer is sealed into, or -1 before the first block
+	Position      int             `xml:"-" json:"-"` // the number of records read from the current block or buffer
+	BlockIterator *BlockIterator  `xml:"-" json:"-"`
+	buffered      bool            // true while reading records from the stream's buffer
+	feed          *bufferFeed     // decodes the stream's buffer while buffered
+	feedBuffer    *bytes.Buffer   // the buffer decoded by the feed
+	feedOffset    int             // the number of bytes of the buffer given to the feed
+	pending       [][]byte
+	err           error // the error returned once the pending records are read
+}
+
+// NewFollowIterator returns a new FollowIterator for the stream.
+func NewFollowIterator(ctx context.Context, s *Stream) *FollowIterator {
+	return &FollowIterator{
+		Stream:  s,
+		Context: ctx,
+		BlockID: -1,
+		pending: make([][]byte, 0),
+	}
+}
+
+// Next returns the bytes of the next object in the stream, blocking until one is available.
+func (it *FollowIterator) Next() ([]byte, error) {
+	for {
+
+		if len(it.pending) > 0 {
+			b := it.pending[0]
+			it.pending = it.pending[1:]
+			it.Position += 1
+			return b, nil
+		}
+
+		if it.err != nil {
+			return make([]byte, 0), it.err
+		}
+
+		if it.BlockIterator != nil {
+			b, err := it.BlockIterator.Next()
+			if err == nil {
+				it.Position += 1
+				return b, nil
+			}
+			if err != io.EOF {
+				return b, err
+			}
+			err = it.BlockIterator.Close()
+			if err != nil {
+				return make([]byte, 0), errors.Wrap(err, "Error closing block iterator")
+			}
+			it.BlockIterator = nil
+		}
+
+		s := it.Stream
+		s.mutex.Lock()
+
+		index, offset := it.seek()
+
+		if index < len(s.Blocks) {
+			block := s.Blocks[index]
+			blocks := []Block{block}
+			s.acquire(blocks)
+			s.mutex.Unlock()
+			err := it.open(block, offset)
+			s.release(blocks)
+			if err != nil {
+				return make([]byte, 0), err
+			}
+			continue
+		}
+
+		if !it.buffered || it.BlockID != s.bufferID {
+			it.closeFeed()
+			it.buffered = true
+			it.BlockID = s.bufferID
+			it.Position = 0
+		}
+
+		var flushed []byte
+		if s.Buffer != nil {
+			if it.feed == nil || it.feedBuffer != s.Buffer {
+				it.closeFeed()
+				it.feed = newBufferFeed(s.Algorithm, s.BigEndian, s.Transform)
+				it.feedBuffer = s.Buffer
+			}
+			if s.Buffer.Len() > it.feedOffset {
+				flushed = append(make([]byte, 0, s.Buffer.Len()-it.feedOffset), s.Buffer.Bytes()[it.feedOffset:]...)
+			}
+		}
+		closed := s.closed
+		changes := s.changes()
+		s.mutex.Unlock()
+
+		if closed {
+			return make([]byte, 0), io.EOF
+		}
+
+		if len(flushed) > 0 {
+			it.feedOffset += len(flushed)
+			records, err := it.feed.push(flushed)
+			if err != nil {
+				it.err = errors.Wrap(err, "Error decoding records in buffer")
+			}
+			it.pending = records
+			continue
+		}
+
+		select {
+		case <-changes:
+		case <-it.Context.Done():
+			return make([]byte, 0), it.Context.Err()
+		}
+	}
+}
+
+// seek returns the index of the next block to read and the number of records to skip in it.
+// If the index is equal to the number of blocks, then the next records are in the buffer.
+// The caller must hold the stream's mutex.
+func (it *FollowIterator) seek() (int, int) {
+	s := it.Stream
+
+	if it.BlockID < 0 {
+		return 0, 0
+	}
+
+	// Skip the records already read from the block, or from the buffer that was sealed into the block,
+	// including if the block was compacted into another block.
+	i, offset, ok := s.resolve(Cursor{BlockID: it.BlockID, Offset: it.Position})
+	if ok {
+		if !it.buffered && s.Blocks[i].GetID() == it.BlockID {
+			// Every record of the block was read.
+			return i + 1, 0
+		}
+		return i, offset
+	}
+
+	if it.buffered && it.BlockID == s.bufferID {
+		return len(s.Blocks), 0
+	}
+
+	// The block was evicted, and every block left in the stream is newer.
+	return 0, 0
+}
+
+// open starts reading the block after skipping the given number of records.
+func (it *FollowIterator) open(block Block, offset int) error {
+	bi, err := block.Iterator()
+	if err != nil {
+		return errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(block.GetID()))
+	}
+	err = bi.Skip(offset)
+	if err != nil {
+		bi.Close()
+		return errors.Wrap(err, "Error skipping records already read from block "+fmt.Sprint(block.GetID()))
+	}
+	it.closeFeed()
+	it.buffered = false
+	it.BlockID = block.GetID()
+	it.Position = offset
+	it.BlockIterator = bi
+	return nil
+}
+
+// closeFeed stops decoding the buffer.
+func (it *FollowIterator) closeFeed() {
+	if it.feed != nil {
+		it.feed.close()
+	}
+	it.feed = nil
+	it.feedBuffer = nil
+	it.feedOffset = 0
+}
+
+// Close closes the iterator's current BlockIterator and stops decoding the buffer.
+func (it *FollowIterator) Close() error {
+	it.closeFeed()
+	if it.BlockIterator == nil {
+		return nil
+	}
+	err := it.BlockIterator.Close()
+	it.BlockIterator = nil
+	return err
+}
+
+// bufferFeed decodes the records of a stream's buffer in the background as the buffer's bytes are flushed,
+// so every byte is decompressed once no matter how often the follower wakes up.
+// The decoder reads from the feed, and blocks while it waits for more bytes.
+type bufferFeed struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	input   []byte   // the bytes pushed to the feed that the decoder has not read yet
+	records [][]byte // the records decoded since the last push
+	err     error    // the error that stopped the decoder, if any
+	idle    bool     // true while the decoder waits for more bytes
+	done    bool     // true once the decoder has stopped
+	closed  bool     // true once the feed is closed
+}
+
+// newBufferFeed returns a new bufferFeed that decodes bytes compressed with the algorithm.
+func newBufferFeed(algorithm string, bigEndian bool, transform string) *bufferFeed {
+	f := &bufferFeed{}
+	f.cond = sync.NewCond(&f.mutex)
+	go f.decode(algorithm, bigEndian, transform)
+	return f
+}
+
+// decode decodes records from the feed until the feed is closed or an error occurs.
+func (f *bufferFeed) decode(algorithm string, bigEndian bool, transform string) {
+	err := func() error {
+		reader := &Reader{}
+		switch algorithm {
+		case "snappy":
+			reader.Reader = snappy.NewReader(f)
+		case "gzip":
+			gr, err := gzip.NewReader(f)
+			if err != nil {
+				return errors.Wrap(err, "Error creating gzip reader for buffer.")
+			}
+			reader.ReadCloser = gr
+		case "none":
+			reader.Reader = f
+		default:
+			return errors.New("Unknown compression algorithm \"" + algorithm + "\"")
+		}
+		bi := &BlockIterator{Reader: reader, BigEndian: bigEndian, Transform: transform}
+		defer bi.Close()
+		for {
+			b, err := bi.Next()
+			if err != nil {
+				return err
+			}
+			f.mutex.Lock()
+			f.records = append(f.records, b)
+			f.mutex.Unlock()
+		}
+	}()
+	f.mutex.Lock()
+	if !f.closed {
+		f.err = err
+	}
+	f.done = true
+	f.cond.Broadcast()
+	f.mutex.Unlock()
+}
+
+// Read reads bytes pushed to the feed, blocking until bytes are pushed.  Returns io.EOF once the feed is closed.
+func (f *bufferFeed) Read(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for len(f.input) == 0 {
+		if f.closed {
+			return 0, io.EOF
+		}
+		f.idle = true
+		f.cond.Broadcast()
+		f.cond.Wait()
+	}
+	f.idle = false
+	n := copy(p, f.input)
+	f.input = f.input[n:]
+	return n, nil
+}
+
+// push gives the bytes to the decoder, waits until it has decoded every complete record, and returns those records.
+// A partial record at the end is returned by a later push once the rest of its bytes are pushed.
+func (f *bufferFeed) push(b []byte) ([][]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.input = append(f.input, b...)
+	f.idle = false
+	f.cond.Broadcast()
+	for !f.done && !(f.idle && len(f.input) == 0) {
+		f.cond.Wait()
+	}
+	records := f.records
+	f.records = nil
+	return records, f.err
+}
+
+// close stops the decoder.
+func (f *bufferFeed) close() {
+	f.mutex.Lock()
+	f.closed = true
+	f.input = nil
+	f.cond.Broadcast()
+	f.mutex.Unlock()
+}
@@ -0,0 +1,121 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// followAll reads the follow iterator in a goroutine and returns a channel that receives every object once it returns io.EOF.
+func followAll(t *testing.T, it *FollowIterator) chan []string {
+	done := make(chan []string, 1)
+	go func() {
+		defer it.Close()
+		objects := make([]string, 0)
+		for {
+			b, err := it.Next()
+			if err != nil {
+				done <- objects
+				return
+			}
+			objects = append(objects, string(b))
+		}
+	}()
+	return done
+}
+
+func TestFollowIterator(t *testing.T) {
+	for _, algorithm := range []string{"snappy", "gzip", "none"} {
+		s := newTestStream(t, algorithm, "memory", 10)
+		appendRecords(t, s, 0, 5)
+		s.Rotate()
+		done := followAll(t, s.Follow(context.Background()))
+		for i := 5; i < 40; i++ {
+			_, err := s.WriteRecord([]byte(testRecord(i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i%3 == 0 {
+				s.Flush()
+			}
+			if i%10 == 9 {
+				s.Rotate()
+			}
+			if i%7 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		s.Close()
+		select {
+		case objects := <-done:
+			expectRecords(t, objects, 0, 40)
+		case <-time.After(10 * time.Second):
+			t.Fatal("follower did not finish")
+		}
+	}
+}
+
+func TestFollowIteratorSealedBuffer(t *testing.T) {
+	s := newTestStream(t, "gzip", "memory", 100)
+	appendRecords(t, s, 0, 3)
+	s.Flush()
+	it := s.Follow(context.Background())
+	defer it.Close()
+	for i := 0; i < 3; i++ {
+		b, err := it.Next()
+		if err != nil || string(b) != testRecord(i) {
+			t.Fatal(string(b), err)
+		}
+	}
+	appendRecords(t, s, 3, 6)
+	s.Close()
+	// The records already read from the buffer are skipped in the sealed block.
+	objects := make([]string, 0)
+	for {
+		b, err := it.Next()
+		if err != nil {
+			break
+		}
+		objects = append(objects, string(b))
+	}
+	expectRecords(t, objects, 3, 6)
+}
+
+func TestFollowIteratorContext(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	it := s.Follow(ctx)
+	defer it.Close()
+	_, err := it.Next()
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowIteratorDecodeError(t *testing.T) {
+	s := newTestStream(t, "none", "memory", 10)
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint64(header, uint64(MAXIMUM_SLICE_LENGTH+1))
+	_, err := s.Write(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Flush()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	it := s.Follow(ctx)
+	defer it.Close()
+	_, err = it.Next()
+	if err == nil || err == context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,227 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Reducer aggregates the objects that share a key.
+type Reducer struct {
+	Init   func(key []byte, b []byte) ([]byte, error)       // returns the aggregate for the first object of a key
+	Reduce func(aggregate []byte, b []byte) ([]byte, error) // returns the aggregate with the object added
+	Merge  func(a []byte, b []byte) ([]byte, error)         // returns the combination of two partial aggregates
+}
+
+// CountReducer returns a Reducer that counts the objects for each key.
+// The aggregate is the count as a big-endian uint64.
+func CountReducer() Reducer {
+	return SumReducer(func(b []byte) int64 { return 1 })
+}
+
+// SumReducer returns a Reducer that sums the values returned by valueFn for each key.
+// The aggregate is the sum as a big-endian int64.
+func SumReducer(valueFn func(b []byte) int64) Reducer {
+	encode := func(x int64) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(x))
+		return b
+	}
+	decode := func(b []byte) int64 {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return Reducer{
+		Init: func(key []byte, b []byte) ([]byte, error) {
+			return encode(valueFn(b)), nil
+		},
+		Reduce: func(aggregate []byte, b []byte) ([]byte, error) {
+			return encode(decode(aggregate) + valueFn(b)), nil
+		},
+		Merge: func(a []byte, b []byte) ([]byte, error) {
+			return encode(decode(a) + decode(b)), nil
+		},
+	}
+}
+
+// GroupByOptions are the options for GroupBy.
+type GroupByOptions struct {
+	Algorithm    string // the compression algorithm of the output stream.  Defaults to snappy.
+	BlockSize    int    // the number of objects in each block of the output stream.  Defaults to 1000.
+	BlockType    string // the block type of the output stream: memory or file.  Defaults to memory.
+	TempDir      string // the directory for temp file blocks, including spilled partial aggregates.
+	MemoryBudget int64  // the maximum number of bytes of keys and aggregates held in memory.  Defaults to DefaultMemoryBudget.
+}
+
+// GroupBy aggregates the objects of the iterator by the key returned by keyFn using the reducer,
+// and returns a new closed stream of pairs of key and aggregate, encoded with EncodePair, in key order.
+// Aggregates are kept in memory up to the memory budget, and then spilled as sorted runs into temp file blocks,
+// which are merged at the end.  The iterator is read to the end and closed.
+// Every function of the reducer is required, since Merge is called once aggregates are spilled.
+// If an error occurs, then the output stream and spilled runs are removed.
+func GroupBy(it Iterator, keyFn func(b []byte) []byte, reducer Reducer, options GroupByOptions) (*Stream, error) {
+	defer it.Close()
+
+	if reducer.Init == nil || reducer.Reduce == nil || reducer.Merge == nil {
+		return nil, errors.New("Error grouping objects.  Reducer is missing Init, Reduce, or Merge.")
+	}
+
+	if options.Algorithm == "" {
+		options.Algorithm = "snappy"
+	}
+	if options.BlockSize <= 0 {
+		options.BlockSize = 1000
+	}
+	switch options.BlockType {
+	case "":
+		options.BlockType = "memory"
+	case "memory", "file":
+	default:
+		return nil, errors.New("Invalid block type \"" + options.BlockType + "\" for grouped objects.  Use memory or file.")
+	}
+	budget := options.MemoryBudget
+	if budget <= 0 {
+		budget = DefaultMemoryBudget
+	}
+
+	out, err := New(options.Algorithm, "little", options.BlockSize, options.BlockType, options.TempDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating output stream")
+	}
+	err = out.Init()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error initializing output stream")
+	}
+
+	aggregates := map[string][]byte{}
+	size := int64(0)
+	runs := make([]*Stream, 0)
+	succeeded := false
+	defer func() {
+		for _, run := range runs {
+			run.Close()
+			run.Remove()
+		}
+		if !succeeded {
+			out.Close()
+			out.Remove()
+		}
+	}()
+
+	// flush writes the aggregates in key order to the stream.
+	flush := func(s *Stream) error {
+		keys := make([]string, 0, len(aggregates))
+		for key := range aggregates {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err := s.Append(EncodePair([]byte(key), aggregates[key]))
+			if err != nil {
+				return errors.Wrap(err, "Error writing aggregate")
+			}
+		}
+		aggregates = map[string][]byte{}
+		size = 0
+		return nil
+	}
+
+	spill := func() error {
+		run, err := out.derive("file", options.TempDir)
+		if err != nil {
+			return errors.Wrap(err, "Error creating run for partial aggregates")
+		}
+		runs = append(runs, run)
+		err = flush(run)
+		if err != nil {
+			return err
+		}
+		return run.Close()
+	}
+
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "Error reading from iterator")
+		}
+		key := keyFn(b)
+		aggregate, ok := aggregates[string(key)]
+		var next []byte
+		if ok {
+			next, err = reducer.Reduce(aggregate, b)
+		} else {
+			next, err = reducer.Init(key, b)
+			size += int64(len(key) + 64)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reducing object")
+		}
+		aggregates[string(key)] = next
+		size += int64(len(next) - len(aggregate))
+		if size >= budget {
+			err := spill()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(runs) == 0 {
+		err = flush(out)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if len(aggregates) > 0 {
+			err := spill()
+			if err != nil {
+				return nil, err
+			}
+		}
+		merged, err := MergeWithOptions(lessPairs, MergeOptions{
+			Reducer: func(a []byte, b []byte) ([]byte, error) {
+				key, x, err := DecodePair(a)
+				if err != nil {
+					return nil, err
+				}
+				_, y, err := DecodePair(b)
+				if err != nil {
+					return nil, err
+				}
+				z, err := reducer.Merge(x, y)
+				if err != nil {
+					return nil, err
+				}
+				return EncodePair(key, z), nil
+			},
+		}, runs...)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error merging partial aggregates")
+		}
+		_, err = Sink(merged, out)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error merging partial aggregates")
+		}
+	}
+
+	err = out.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error closing output stream")
+	}
+
+	succeeded = true
+	return out, nil
+}
@@ -0,0 +1,97 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// newGroupStream returns a new closed stream of n objects with 37 distinct keys.
+func newGroupStream(t *testing.T, n int) *Stream {
+	t.Helper()
+	s := newTestStream(t, "snappy", "memory", 10)
+	for i := 0; i < n; i++ {
+		err := s.Append([]byte(fmt.Sprintf("k%02d", i%37)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	return s
+}
+
+func TestGroupBy(t *testing.T) {
+	s := newGroupStream(t, 500)
+	for _, budget := range []int64{0, 300} {
+		it, err := s.Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := GroupBy(it, func(b []byte) []byte { return b }, CountReducer(), GroupByOptions{MemoryBudget: budget, TempDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects := readStream(t, out)
+		total := uint64(0)
+		for i, object := range objects {
+			key, value, err := DecodePair([]byte(object))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(key) != fmt.Sprintf("k%02d", i) {
+				t.Fatalf("expected key k%02d but found %s", i, key)
+			}
+			total += binary.BigEndian.Uint64(value)
+		}
+		if len(objects) != 37 || total != 500 {
+			t.Fatal(budget, len(objects), total)
+		}
+	}
+}
+
+func TestGroupByReducerWithoutMerge(t *testing.T) {
+	s := newGroupStream(t, 50)
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reducer := CountReducer()
+	reducer.Merge = nil
+	_, err = GroupBy(it, func(b []byte) []byte { return b }, reducer, GroupByOptions{MemoryBudget: 100, TempDir: t.TempDir()})
+	if err == nil {
+		t.Fatal("expected an error for a reducer without Merge")
+	}
+}
+
+func TestGroupByErrorRemovesStreams(t *testing.T) {
+	s := newGroupStream(t, 500)
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reducer := CountReducer()
+	merge := reducer.Merge
+	merged := 0
+	reducer.Merge = func(a []byte, b []byte) ([]byte, error) {
+		merged += 1
+		if merged > 20 {
+			return nil, fmt.Errorf("merge failed")
+		}
+		return merge(a, b)
+	}
+	tempDir := t.TempDir()
+	_, err = GroupBy(it, func(b []byte) []byte { return b }, reducer, GroupByOptions{BlockSize: 2, BlockType: "file", MemoryBudget: 300, TempDir: tempDir})
+	if err == nil {
+		t.Fatal("expected an error from Merge")
+	}
+	if n := countFiles(t, tempDir); n != 0 {
+		t.Fatalf("expected no files left in temp dir but found %d", n)
+	}
+}
@@ -0,0 +1,347 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Index is a secondary index that maps the keys of objects to their cursors in a stream.
+// The entries are stored in their own stream as pairs of a key and a marshalled Cursor,
+// with one block sorted by key for every block of the indexed stream.
+type Index struct {
+	Name    string                `xml:"-" json:"-"`
+	KeyFunc func(b []byte) []byte `xml:"-" json:"-"` // returns the key of an object, or nil if the object is not indexed
+	Stream  *Stream               `xml:"-" json:"-"` // the stream of index entries
+	pending []indexEntry          // the entries for the objects written to the buffer of the indexed stream
+	sources map[int]Block         // the block of entries for each block identifier of the indexed stream
+}
+
+// indexEntry is the key of an object and its offset in a block that has not been sealed yet.
+type indexEntry struct {
+	key    []byte
+	offset int
+}
+
+// AddIndex adds a secondary index with the given name to the stream, indexing every existing block.
+// The index is kept up to date as the buffer is rotated into blocks.
+// Returns an error if an index with the name already exists or if the buffer holds objects, which must be rotated first.
+func (s *Stream) AddIndex(name string, keyFn func(b []byte) []byte) (*Index, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.Indexes[name]; ok {
+		return nil, errors.New("Error adding index.  Index \"" + name + "\" already exists.")
+	}
+	if s.count > 0 {
+		return nil, errors.New("Error adding index \"" + name + "\".  Buffer is not empty.")
+	}
+
+	entries, err := s.derive(rowBlockType(s.BlockType), s.TempDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating stream for index \""+name+"\"")
+	}
+	entries.KeyFunc = indexKey
+
+	idx := &Index{
+		Name:    name,
+		KeyFunc: keyFn,
+		Stream:  entries,
+	}
+	err = idx.build(s.Blocks)
+	if err != nil {
+		entries.Remove()
+		return nil, errors.Wrap(err, "Error building index \""+name+"\"")
+	}
+
+	if s.Indexes == nil {
+		s.Indexes = map[string]*Index{}
+	}
+	s.Indexes[name] = idx
+	return idx, nil
+}
+
+// GetByIndex returns the objects whose key in the named index is equal to the given key, in stream order.
+// Entries pointing to blocks that are no longer in the stream are skipped.
+func (s *Stream) GetByIndex(name string, key []byte) ([][]byte, error) {
+	s.mutex.Lock()
+	idx, ok := s.Indexes[name]
+	blocks := s.Blocks
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	defer s.release(blocks)
+
+	if !ok {
+		return nil, errors.New("Error getting objects by index.  Index \"" + name + "\" does not exist.")
+	}
+
+	cursors, err := idx.find(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error searching index \""+name+"\"")
+	}
+
+	objects := make([][]byte, 0, len(cursors))
+	for _, block := range blocks {
+		offsets := make([]int, 0)
+		for _, c := range cursors {
+			if c.BlockID == block.GetID() {
+				offsets = append(offsets, c.Offset)
+			}
+		}
+		if len(offsets) == 0 {
+			continue
+		}
+		sort.Ints(offsets)
+		values, err := readOffsets(block, offsets)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading block "+fmt.Sprint(block.GetID()))
+		}
+		objects = append(objects, values...)
+	}
+	return objects, nil
+}
+
+// readOffsets returns the objects at the sorted offsets in the block, reading the block once.
+func readOffsets(block Block, offsets []int) ([][]byte, error) {
+	it, err := block.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	objects := make([][]byte, 0, len(offsets))
+	position := 0
+	for _, offset := range offsets {
+		err := it.Skip(offset - position)
+		if err != nil {
+			return nil, err
+		}
+		b, err := it.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading object at offset "+fmt.Sprint(offset))
+		}
+		objects = append(objects, b)
+		position = offset + 1
+	}
+	return objects, nil
+}
+
+// indexKey returns the key of an index entry.
+func indexKey(b []byte) []byte {
+	key, _, err := DecodePair(b)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// add records the key of the object written to the buffer at the given offset.
+func (idx *Index) add(b []byte, offset int) {
+	key := idx.KeyFunc(b)
+	if key != nil {
+		idx.pending = append(idx.pending, indexEntry{key: key, offset: offset})
+	}
+}
+
+// seal writes the pending entries as one block sorted by key, pointing to the block with the given identifier.
+func (idx *Index) seal(blockID int) error {
+	if len(idx.pending) == 0 {
+		return nil
+	}
+	pending := idx.pending
+	idx.pending = nil
+	err := idx.write(idx.Stream, blockID, pending)
+	if err != nil {
+		return err
+	}
+	if idx.sources == nil {
+		idx.sources = map[int]Block{}
+	}
+	idx.sources[blockID] = idx.Stream.Blocks[len(idx.Stream.Blocks)-1]
+	return nil
+}
+
+// write writes the entries to the stream sorted by key, pointing to the block with the given identifier,
+// and rotates them into one block.
+func (idx *Index) write(w *Stream, blockID int, entries []indexEntry) error {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return idx.Stream.compare(entries[i].key, entries[j].key) < 0
+	})
+	for _, entry := range entries {
+		c, _ := Cursor{BlockID: blockID, Offset: entry.offset}.MarshalBinary()
+		_, err := w.WriteRecord(EncodePair(entry.key, c))
+		if err != nil {
+			return errors.Wrap(err, "Error writing index entry")
+		}
+	}
+	return w.Rotate()
+}
+
+// indexBlock is a block of index entries for the block of the indexed stream with the source identifier.
+type indexBlock struct {
+	source int
+	block  Block
+}
+
+// entries returns new blocks of index entries for the blocks, which are not added to the index.
+// The index is not locked, so the entries can be built while the indexed stream is written.
+func (idx *Index) entries(blocks []Block) ([]indexBlock, error) {
+	w, err := idx.Stream.derive(idx.Stream.BlockType, idx.Stream.TempDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating stream for index entries")
+	}
+	w.KeyFunc = indexKey
+	sources := make([]int, 0, len(blocks))
+	for _, block := range blocks {
+		it, err := block.Iterator()
+		if err != nil {
+			w.Remove()
+			return nil, errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(block.GetID()))
+		}
+		entries := make([]indexEntry, 0)
+		for offset := 0; ; offset++ {
+			b, err := it.Next()
+			if err != nil {
+				it.Close()
+				if err == io.EOF {
+					break
+				}
+				w.Remove()
+				return nil, errors.Wrap(err, "Error reading block "+fmt.Sprint(block.GetID()))
+			}
+			if key := idx.KeyFunc(b); key != nil {
+				entries = append(entries, indexEntry{key: key, offset: offset})
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		err = idx.write(w, block.GetID(), entries)
+		if err != nil {
+			w.Remove()
+			return nil, err
+		}
+		sources = append(sources, block.GetID())
+	}
+	built := make([]indexBlock, 0, len(sources))
+	for i, source := range sources {
+		built = append(built, indexBlock{source: source, block: w.Blocks[i]})
+	}
+	return built, nil
+}
+
+// replace replaces the entries for the old blocks of the indexed stream with the blocks of entries built by entries.
+func (idx *Index) replace(old []Block, built []indexBlock) {
+	idx.evict(old)
+	idx.Stream.mutex.Lock()
+	defer idx.Stream.mutex.Unlock()
+	if idx.sources == nil {
+		idx.sources = map[int]Block{}
+	}
+	for _, ib := range built {
+		ib.block.SetID(idx.Stream.nextBlockID)
+		idx.Stream.nextBlockID += 1
+		idx.Stream.Blocks = append(idx.Stream.Blocks, ib.block)
+		idx.sources[ib.source] = ib.block
+	}
+}
+
+// removeIndexBlocks removes the blocks of index entries.
+func removeIndexBlocks(built []indexBlock) {
+	for _, ib := range built {
+		ib.block.Remove()
+	}
+}
+
+// evict removes the entries for the blocks evicted from the indexed stream.
+func (idx *Index) evict(blocks []Block) {
+	removed := map[Block]bool{}
+	for _, block := range blocks {
+		if entries, ok := idx.sources[block.GetID()]; ok {
+			removed[entries] = true
+			delete(idx.sources, block.GetID())
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	idx.Stream.mutex.Lock()
+	defer idx.Stream.mutex.Unlock()
+	kept := make([]Block, 0, len(idx.Stream.Blocks))
+	evicted := make([]Block, 0, len(removed))
+	for _, block := range idx.Stream.Blocks {
+		if removed[block] {
+			evicted = append(evicted, block)
+		} else {
+			kept = append(kept, block)
+		}
+	}
+	idx.Stream.Blocks = kept
+	idx.Stream.retire(evicted)
+}
+
+// build indexes the objects in the blocks.
+func (idx *Index) build(blocks []Block) error {
+	for _, block := range blocks {
+		it, err := block.Iterator()
+		if err != nil {
+			return errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(block.GetID()))
+		}
+		for offset := 0; ; offset++ {
+			b, err := it.Next()
+			if err != nil {
+				it.Close()
+				if err == io.EOF {
+					break
+				}
+				return errors.Wrap(err, "Error reading block "+fmt.Sprint(block.GetID()))
+			}
+			idx.add(b, offset)
+		}
+		err = idx.seal(block.GetID())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// find returns the cursors of the objects with the key.
+// Blocks of entries whose statistics rule out the key are skipped.
+func (idx *Index) find(key []byte) ([]Cursor, error) {
+	it, err := idx.Stream.Scan(KeyEquals(key))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	cursors := make([]Cursor, 0)
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return cursors, nil
+			}
+			return nil, err
+		}
+		_, value, err := DecodePair(b)
+		if err != nil {
+			return nil, err
+		}
+		c := Cursor{}
+		err = c.UnmarshalBinary(value)
+		if err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, c)
+	}
+}
@@ -0,0 +1,97 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+// appendModRecords appends objects with the key of the "mod" index from position start up to but excluding end.
+func appendModRecords(t *testing.T, s *Stream, start int, end int) {
+	t.Helper()
+	for i := start; i < end; i++ {
+		err := s.Append([]byte(fmt.Sprintf("%03d-%d", i, i%4)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// modKey returns the key of an object written by appendModRecords.
+func modKey(b []byte) []byte {
+	return b[4:]
+}
+
+// expectMod fails the test unless the "mod" index returns the n objects with key 3.
+func expectMod(t *testing.T, s *Stream, n int) {
+	t.Helper()
+	objects, err := s.GetByIndex("mod", []byte("3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != n {
+		t.Fatalf("expected %d objects but found %d", n, len(objects))
+	}
+	for i, object := range objects {
+		if expected := fmt.Sprintf("%03d-3", i*4+3); string(object) != expected {
+			t.Fatalf("expected %q at position %d but found %q", expected, i, object)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	s := newTestStream(t, "gzip", "memory", 10)
+	appendModRecords(t, s, 0, 25)
+	s.Rotate()
+	_, err := s.AddIndex("mod", modKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendModRecords(t, s, 25, 50)
+	s.Close()
+	expectMod(t, s, 12)
+	_, err = s.GetByIndex("missing", nil)
+	if err == nil {
+		t.Fatal("expected an error for a missing index")
+	}
+}
+
+func TestIndexCompact(t *testing.T) {
+	s := newTestStream(t, "gzip", "memory", 10)
+	_, err := s.AddIndex("mod", modKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendModRecords(t, s, 0, 100)
+	s.Rotate()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		appendModRecords(t, s, 100, 200)
+	}()
+	err = s.Compact(50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	s.Close()
+	expectMod(t, s, 50)
+	// The entries for the compacted blocks are replaced by one block of entries for each new block.
+	// Blocks without objects have no entries.
+	n := 0
+	for _, block := range s.Blocks {
+		if block.GetCount() > 0 {
+			n += 1
+		}
+	}
+	idx := s.Indexes["mod"]
+	if len(idx.Stream.Blocks) != n || len(idx.sources) != n {
+		t.Fatalf("expected %d blocks of entries but found %d", n, len(idx.Stream.Blocks))
+	}
+}
@@ -0,0 +1,328 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"io"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	JoinInner = "inner" // returns the combination of every left object with every right object with the same key
+	JoinLeft  = "left"  // like inner, but also returns the combination of every left object without a match with nil
+	JoinAnti  = "anti"  // returns every left object without a matching right object
+)
+
+// JoinOptions are the options for Join.
+type JoinOptions struct {
+	MemoryBudget int64  // the maximum number of bytes of the objects of one stream held in memory for a hash join.  Defaults to DefaultMemoryBudget.
+	TempDir      string // the directory for the sorted copies of a sort-merge join.  Defaults to the left stream's TempDir.
+}
+
+// Join joins the objects of the left and right streams by the keys returned by leftKey and rightKey,
+// and returns a new closed stream of the objects returned by combine.  The kind is inner, left, or anti.
+// With a left join, combine is called with a nil right object for left objects without a match.
+// With an anti join, combine is not called and the left objects are written as is.
+// If the right stream fits in the memory budget, then a hash join is used and the output is in the order of the left stream.
+// Otherwise, if the left stream fits in the memory budget, then a hash join is used with the left stream in memory.
+// The combined objects are in the order of the right stream, followed by the left objects without a match in the order of the left stream.
+// Otherwise, both streams are sorted by key into temp file blocks and merged, and the output is in key order.
+// If an error occurs, then the new stream is removed.
+// The new stream uses the same algorithm, endianness, block size, block type, and temp directory as the left stream,
+// except columnar blocks, since the combined objects are not objects of the left stream.
+func Join(left *Stream, right *Stream, leftKey func(b []byte) []byte, rightKey func(b []byte) []byte, kind string, combine func(l []byte, r []byte) ([]byte, error), options JoinOptions) (*Stream, error) {
+
+	switch kind {
+	case JoinInner, JoinLeft, JoinAnti:
+	default:
+		return nil, errors.New("Unknown join kind \"" + kind + "\"")
+	}
+
+	budget := options.MemoryBudget
+	if budget <= 0 {
+		budget = DefaultMemoryBudget
+	}
+
+	out, err := left.derive(rowBlockType(left.BlockType), left.TempDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating output stream")
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			out.Close()
+			out.Remove()
+		}
+	}()
+
+	// emit writes the output objects for a left object and its matching right objects.
+	emit := func(l []byte, matches [][]byte) error {
+		switch kind {
+		case JoinAnti:
+			if len(matches) == 0 {
+				return out.Append(l)
+			}
+			return nil
+		case JoinLeft:
+			if len(matches) == 0 {
+				b, err := combine(l, nil)
+				if err != nil {
+					return errors.Wrap(err, "Error combining objects")
+				}
+				return out.Append(b)
+			}
+		}
+		for _, r := range matches {
+			b, err := combine(l, r)
+			if err != nil {
+				return errors.Wrap(err, "Error combining objects")
+			}
+			err = out.Append(b)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = join(left, right, leftKey, rightKey, budget, options, emit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error closing output stream")
+	}
+
+	succeeded = true
+	return out, nil
+}
+
+// join calls emit for every object of the left stream with its matches in the right stream,
+// using a hash join on the first stream that fits in the memory budget, or a sort-merge join if neither fits.
+func join(left *Stream, right *Stream, leftKey func(b []byte) []byte, rightKey func(b []byte) []byte, budget int64, options JoinOptions, emit func(l []byte, matches [][]byte) error) error {
+
+	table, err := buildHashTable(right, rightKey, budget)
+	if err != nil {
+		return errors.Wrap(err, "Error reading right stream")
+	}
+	if table != nil {
+		return hashJoin(left, leftKey, table, emit)
+	}
+
+	table, err = buildHashTable(left, leftKey, budget)
+	if err != nil {
+		return errors.Wrap(err, "Error reading left stream")
+	}
+	if table != nil {
+		return hashJoinLeft(right, rightKey, table, emit)
+	}
+
+	return sortMergeJoin(left, right, leftKey, rightKey, options, emit)
+}
+
+// hashTable is the objects of a stream grouped by key.
+type hashTable struct {
+	objects   [][]byte         // the objects in the order of the stream
+	positions map[string][]int // the positions in objects of the objects with each key
+}
+
+// matches returns the objects with the key.
+func (t *hashTable) matches(key []byte) [][]byte {
+	positions := t.positions[string(key)]
+	if len(positions) == 0 {
+		return nil
+	}
+	matches := make([][]byte, 0, len(positions))
+	for _, p := range positions {
+		matches = append(matches, t.objects[p])
+	}
+	return matches
+}
+
+// buildHashTable returns the objects of the stream grouped by key, or nil if they do not fit in the memory budget.
+// The stream is read until the budget is exceeded, so a large stream is not read to the end.
+func buildHashTable(s *Stream, keyFn func(b []byte) []byte, budget int64) (*hashTable, error) {
+	table := &hashTable{objects: make([][]byte, 0), positions: map[string][]int{}}
+	it, err := s.open()
+	if err != nil || it == nil {
+		return table, err
+	}
+	defer it.Close()
+	size := int64(0)
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return table, nil
+			}
+			return nil, err
+		}
+		key := keyFn(b)
+		table.positions[string(key)] = append(table.positions[string(key)], len(table.objects))
+		table.objects = append(table.objects, b)
+		size += int64(len(key) + len(b) + 32)
+		if size > budget {
+			return nil, nil
+		}
+	}
+}
+
+// hashJoin calls emit for every object of the left stream with its matches in the table of right objects.
+func hashJoin(left *Stream, leftKey func(b []byte) []byte, table *hashTable, emit func(l []byte, matches [][]byte) error) error {
+	it, err := left.open()
+	if err != nil {
+		return errors.Wrap(err, "Error creating iterator for left stream")
+	}
+	if it == nil {
+		return nil
+	}
+	defer it.Close()
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "Error reading left stream")
+		}
+		err = emit(b, table.matches(leftKey(b)))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// hashJoinLeft calls emit for every object of the right stream with each of its matches in the table of left objects,
+// and then calls emit for every left object without a match, so left and anti joins can write them.
+func hashJoinLeft(right *Stream, rightKey func(b []byte) []byte, table *hashTable, emit func(l []byte, matches [][]byte) error) error {
+	matched := make([]bool, len(table.objects))
+	it, err := right.open()
+	if err != nil {
+		return errors.Wrap(err, "Error creating iterator for right stream")
+	}
+	if it != nil {
+		defer it.Close()
+		for {
+			r, err := it.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return errors.Wrap(err, "Error reading right stream")
+			}
+			for _, p := range table.positions[string(rightKey(r))] {
+				matched[p] = true
+				err := emit(table.objects[p], [][]byte{r})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for p, l := range table.objects {
+		if !matched[p] {
+			err := emit(l, nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sortMergeJoin sorts both streams by key and calls emit for every object of the left stream with its matches.
+// The right objects for one key are held in memory.
+func sortMergeJoin(left *Stream, right *Stream, leftKey func(b []byte) []byte, rightKey func(b []byte) []byte, options JoinOptions, emit func(l []byte, matches [][]byte) error) error {
+
+	// The sorted copies are kept in temp file blocks, since the streams did not fit in the memory budget.
+	tempDir := options.TempDir
+	if tempDir == "" {
+		tempDir = left.TempDir
+	}
+	sortOptions := SortOptions{MemoryBudget: options.MemoryBudget, TempDir: tempDir, BlockType: "file"}
+
+	sortedLeft, err := Sort(left, func(a, b []byte) bool { return bytes.Compare(leftKey(a), leftKey(b)) < 0 }, sortOptions)
+	if err != nil {
+		return errors.Wrap(err, "Error sorting left stream")
+	}
+	defer sortedLeft.Remove()
+
+	sortedRight, err := Sort(right, func(a, b []byte) bool { return bytes.Compare(rightKey(a), rightKey(b)) < 0 }, sortOptions)
+	if err != nil {
+		return errors.Wrap(err, "Error sorting right stream")
+	}
+	defer sortedRight.Remove()
+
+	li, err := sortedLeft.open()
+	if err != nil {
+		return errors.Wrap(err, "Error creating iterator for left stream")
+	}
+	if li == nil {
+		return nil
+	}
+	defer li.Close()
+
+	ri, err := sortedRight.open()
+	if err != nil {
+		return errors.Wrap(err, "Error creating iterator for right stream")
+	}
+	var r []byte
+	rok := false
+	if ri != nil {
+		defer ri.Close()
+		r, err = ri.Next()
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "Error reading right stream")
+		}
+		rok = err == nil
+	}
+
+	var groupKey []byte
+	started := false
+	group := make([][]byte, 0)
+	for {
+		l, err := li.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "Error reading left stream")
+		}
+		key := leftKey(l)
+		if !started || !bytes.Equal(key, groupKey) {
+			started = true
+			groupKey = key
+			group = make([][]byte, 0)
+			for rok && bytes.Compare(rightKey(r), key) < 0 {
+				r, err = ri.Next()
+				if err != nil && err != io.EOF {
+					return errors.Wrap(err, "Error reading right stream")
+				}
+				rok = err == nil
+			}
+			for rok && bytes.Equal(rightKey(r), key) {
+				group = append(group, r)
+				r, err = ri.Next()
+				if err != nil && err != io.EOF {
+					return errors.Wrap(err, "Error reading right stream")
+				}
+				rok = err == nil
+			}
+		}
+		err = emit(l, group)
+		if err != nil {
+			return err
+		}
+	}
+}
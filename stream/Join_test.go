@@ -0,0 +1,102 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	left := newTestStream(t, "snappy", "memory", 10)
+	for i := 0; i < 50; i++ {
+		err := left.Append([]byte(fmt.Sprintf("%02d:L%d", i%20, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	left.Close()
+	right := newTestStream(t, "snappy", "file", 10)
+	for i := 0; i < 10; i++ {
+		err := right.Append([]byte(fmt.Sprintf("%02d:R", i*2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	right.Close()
+	key := func(b []byte) []byte { return b[:2] }
+	combine := func(l, r []byte) ([]byte, error) { return []byte(string(l) + "+" + string(r)), nil }
+	// A budget of 50 bytes forces a sort-merge join.
+	for _, budget := range []int64{0, 50} {
+		tempDir := t.TempDir()
+		counts := make([]int, 0)
+		for _, kind := range []string{JoinInner, JoinLeft, JoinAnti} {
+			out, err := Join(left, right, key, key, kind, combine, JoinOptions{MemoryBudget: budget, TempDir: tempDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts = append(counts, len(readStream(t, out)))
+		}
+		if fmt.Sprint(counts) != "[25 50 25]" {
+			t.Fatal(budget, counts)
+		}
+		// The sorted copies are removed once the join is done.
+		if n := countFiles(t, tempDir); n != 0 {
+			t.Fatalf("expected no files left in temp dir but found %d", n)
+		}
+	}
+}
+
+func TestJoinLeftInMemory(t *testing.T) {
+	left := newTestStream(t, "snappy", "memory", 10)
+	for i := 0; i < 7; i++ {
+		err := left.Append([]byte(fmt.Sprintf("%02d:L%d", i%3, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := left.Append([]byte("09:L7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	left.Close()
+	right := newTestStream(t, "snappy", "memory", 10)
+	for i := 0; i < 60; i++ {
+		err := right.Append([]byte(fmt.Sprintf("%02d:R%02d", i%8, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	right.Close()
+	key := func(b []byte) []byte { return b[:2] }
+	combine := func(l, r []byte) ([]byte, error) { return []byte(string(l) + "+" + string(r)), nil }
+	for _, kind := range []string{JoinInner, JoinLeft, JoinAnti} {
+		// A budget of 500 bytes fits the left stream but not the right stream.
+		// A budget of 50 bytes fits neither, so a sort-merge join gives the expected objects.
+		results := make([][]string, 0, 2)
+		for _, budget := range []int64{500, 50} {
+			out, err := Join(left, right, key, key, kind, combine, JoinOptions{MemoryBudget: budget, TempDir: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, readStream(t, out))
+		}
+		if kind == JoinInner && fmt.Sprint(results[0][:2]) != "[00:L0+00:R00 00:L3+00:R00]" {
+			t.Fatalf("expected the objects in the order of the right stream but found %v", results[0][:2])
+		}
+		if kind == JoinAnti && fmt.Sprint(results[0]) != "[09:L7]" {
+			t.Fatalf("expected the left object without a match but found %v", results[0])
+		}
+		sort.Strings(results[0])
+		sort.Strings(results[1])
+		if fmt.Sprint(results[0]) != fmt.Sprint(results[1]) {
+			t.Fatalf("%s: expected %v but found %v", kind, results[1], results[0])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// MayContain returns false if no object in the stream has the given key, and true if one may.
+// The answer uses the bloom filter and statistics of every block and the keys of the objects in the buffer,
+// so no block is read.  Blocks without a bloom filter or statistics may contain any key.
+func (s *Stream) MayContain(key []byte) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.KeyFunc == nil {
+		return true
+	}
+	for _, block := range s.Blocks {
+		if mayContain(block, key) {
+			return true
+		}
+	}
+	if s.count > 0 {
+		if s.stats != nil && !KeyEquals(key).MayMatch(s.stats) {
+			return false
+		}
+		if s.BloomFilterRate > 0 {
+			hash := bloomHash(key)
+			for _, h := range s.hashes {
+				if h == hash {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// Lookup returns an iterator over the objects in the stream with the given key, returned by KeyFunc.
+// Only blocks that may contain the key, according to their bloom filter and statistics, are read.
+// Objects in the buffer are not included until the buffer is rotated into a block.
+func (s *Stream) Lookup(key []byte) (Iterator, error) {
+	if s.KeyFunc == nil {
+		return nil, errors.New("Error looking up key.  KeyFunc is nil.")
+	}
+	keyFn := s.KeyFunc
+	return s.scan(func(block Block) bool {
+		return mayContain(block, key)
+	}, func(b []byte) bool {
+		return bytes.Equal(keyFn(b), key)
+	}), nil
+}
+
+// mayContain returns false if the block's bloom filter or statistics rule out the key.
+func mayContain(block Block, key []byte) bool {
+	if stats := block.GetStats(); stats != nil && !KeyEquals(key).MayMatch(stats) {
+		return false
+	}
+	if filter := block.GetFilter(); filter != nil && !filter.MayContain(key) {
+		return false
+	}
+	return true
+}
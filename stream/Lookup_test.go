@@ -0,0 +1,86 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		bf.Add([]byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if !bf.MayContain([]byte(fmt.Sprint(i))) {
+			t.Fatalf("expected filter to contain %d", i)
+		}
+	}
+	positives := 0
+	for i := 1000; i < 11000; i++ {
+		if bf.MayContain([]byte(fmt.Sprint(i))) {
+			positives += 1
+		}
+	}
+	if positives > 300 {
+		t.Fatalf("expected about 100 false positives but found %d", positives)
+	}
+	b, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &BloomFilter{}
+	err = other.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if !other.MayContain([]byte(fmt.Sprint(i))) {
+			t.Fatalf("expected unmarshalled filter to contain %d", i)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.KeyFunc = func(b []byte) []byte { return b[:3] }
+	s.BloomFilterRate = 0.01
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		err := s.Append([]byte(fmt.Sprintf("%03d-x", (i*7)%100)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = s.WriteRecord([]byte("500-y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Blocks[0].GetFilter() == nil {
+		t.Fatal("expected a bloom filter for the block")
+	}
+	// Keys in the buffer are included.
+	if !s.MayContain([]byte("042")) || !s.MayContain([]byte("500")) || s.MayContain([]byte("777")) {
+		t.Fatal("unexpected membership")
+	}
+	it, err := s.Lookup([]byte("042"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := readAll(t, it)
+	if len(objects) != 1 || objects[0] != "042-x" {
+		t.Fatal(objects)
+	}
+}
@@ -38,7 +38,7 @@ func (mb *MemoryBlock) Reader() (*Reader, error) {
 		return &Reader{Reader: snappy.NewReader(bytes.NewReader(mb.Bytes))}, nil
   case "gzip":
 		gr, err := gzip.NewReader(bytes.NewReader(mb.Bytes))
-		if gr != nil {
+		if err != nil {
 			return nil, errors.Wrap(err, "Error creating gzip reader for memory block.")
 		}
 		return &Reader{ReadCloser: gr}, nil
@@ -58,6 +58,7 @@ func (mb *MemoryBlock) Iterator() (*BlockIterator, error) {
   it := &BlockIterator{
     Reader: reader,
     BigEndian: mb.UseBigEndian(),
+    Transform: mb.GetTransform(),
   }
 
   return it, nil
@@ -98,6 +99,7 @@ func (mb *MemoryBlock) Remove() error {
 func NewMemoryBlock(algorithm string, bigEndian bool) *MemoryBlock {
   return &MemoryBlock{
 		AbstractBlock: AbstractBlock{
+				Count: -1,
 				Algorithm: algorithm,
 				BigEndian: bigEndian,
 			},
@@ -0,0 +1,222 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	DuplicatesKeepAll   = "all"   // every object is returned
+	DuplicatesKeepFirst = "first" // only the first of equal objects is returned
+	DuplicatesKeepLast  = "last"  // only the last of equal objects is returned
+)
+
+// MergeOptions are the options for a MergeIterator.
+// Two objects are duplicates if neither is less than the other.
+// Equal objects are ordered by the position of their source in the list of inputs.
+type MergeOptions struct {
+	Duplicates string                            // how to handle duplicates: all, first, or last.  Defaults to all.
+	Reducer    func(a, b []byte) ([]byte, error) // if not nil, duplicates are combined with the reducer instead.
+}
+
+// MergeIterator is an iterator that merges multiple sorted iterators into one sorted sequence
+// using a heap over the head object of each iterator.
+type MergeIterator struct {
+	Less    func(a, b []byte) bool `xml:"-" json:"-"`
+	Options MergeOptions           `xml:"-" json:"-"`
+	heap    *mergeHeap
+}
+
+// Merge returns a new MergeIterator over the objects of the sorted streams.
+func Merge(less func(a, b []byte) bool, streams ...*Stream) (*MergeIterator, error) {
+	return MergeWithOptions(less, MergeOptions{}, streams...)
+}
+
+// MergeWithOptions returns a new MergeIterator over the objects of the sorted streams using the given options.
+func MergeWithOptions(less func(a, b []byte) bool, options MergeOptions, streams ...*Stream) (*MergeIterator, error) {
+	iterators := make([]Iterator, 0, len(streams))
+	for i, s := range streams {
+		it, err := s.open()
+		if err != nil {
+			closeAll(iterators)
+			return nil, errors.Wrap(err, "Error creating iterator for stream "+fmt.Sprint(i))
+		}
+		if it == nil {
+			continue
+		}
+		iterators = append(iterators, it)
+	}
+	return NewMergeIterator(less, options, iterators...)
+}
+
+// NewMergeIterator returns a new MergeIterator over the objects of the sorted iterators.
+func NewMergeIterator(less func(a, b []byte) bool, options MergeOptions, iterators ...Iterator) (*MergeIterator, error) {
+
+	switch options.Duplicates {
+	case "":
+		options.Duplicates = DuplicatesKeepAll
+	case DuplicatesKeepAll, DuplicatesKeepFirst, DuplicatesKeepLast:
+	default:
+		closeAll(iterators)
+		return nil, errors.New("Unknown duplicate handling \"" + options.Duplicates + "\"")
+	}
+
+	h, err := newMergeHeap(less, iterators)
+	if err != nil {
+		closeAll(iterators)
+		return nil, errors.Wrap(err, "Error creating merge iterator")
+	}
+
+	it := &MergeIterator{
+		Less:    less,
+		Options: options,
+		heap:    h,
+	}
+
+	return it, nil
+}
+
+// Next returns the next object in sorted order, and an error if any.  Returns io.EOF when every input is exhausted.
+func (it *MergeIterator) Next() ([]byte, error) {
+	b, _, err := it.heap.Next()
+	if err != nil {
+		return b, err
+	}
+
+	if it.Options.Reducer == nil && it.Options.Duplicates == DuplicatesKeepAll {
+		return b, nil
+	}
+
+	for {
+		next, ok := it.heap.Peek()
+		if !ok || it.Less(b, next) || it.Less(next, b) {
+			return b, nil
+		}
+		next, _, err := it.heap.Next()
+		if err != nil {
+			return make([]byte, 0), err
+		}
+		if it.Options.Reducer != nil {
+			b, err = it.Options.Reducer(b, next)
+			if err != nil {
+				return make([]byte, 0), errors.Wrap(err, "Error reducing duplicate objects")
+			}
+		} else if it.Options.Duplicates == DuplicatesKeepLast {
+			b = next
+		}
+	}
+}
+
+// Close closes every input iterator.
+func (it *MergeIterator) Close() error {
+	return it.heap.Close()
+}
+
+// mergeItem is the head object of one of the iterators being merged.
+type mergeItem struct {
+	value []byte
+	index int // the index of the source iterator
+}
+
+// mergeHeap is a min-heap over the head objects of multiple sorted iterators.
+// Objects that are equal are returned in the order of their source iterators.
+type mergeHeap struct {
+	less      func(a, b []byte) bool
+	iterators []Iterator
+	items     []mergeItem
+}
+
+// newMergeHeap returns a new mergeHeap primed with the first object of every iterator.
+func newMergeHeap(less func(a, b []byte) bool, iterators []Iterator) (*mergeHeap, error) {
+	h := &mergeHeap{
+		less:      less,
+		iterators: iterators,
+		items:     make([]mergeItem, 0, len(iterators)),
+	}
+	for i, it := range iterators {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return nil, errors.Wrap(err, "Error reading from iterator "+fmt.Sprint(i))
+		}
+		h.items = append(h.items, mergeItem{value: b, index: i})
+	}
+	heap.Init(h)
+	return h, nil
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	if h.less(h.items[i].value, h.items[j].value) {
+		return true
+	}
+	if h.less(h.items[j].value, h.items[i].value) {
+		return false
+	}
+	return h.items[i].index < h.items[j].index
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
+
+// Peek returns the smallest object without removing it, and false if the heap is empty.
+func (h *mergeHeap) Peek() ([]byte, bool) {
+	if len(h.items) == 0 {
+		return nil, false
+	}
+	return h.items[0].value, true
+}
+
+// Next removes and returns the smallest object and the index of its source iterator,
+// and then advances that iterator.  Returns io.EOF when every iterator is exhausted.
+func (h *mergeHeap) Next() ([]byte, int, error) {
+	if len(h.items) == 0 {
+		return make([]byte, 0), -1, io.EOF
+	}
+	item := h.items[0]
+	b, err := h.iterators[item.index].Next()
+	if err != nil {
+		if err != io.EOF {
+			return make([]byte, 0), -1, errors.Wrap(err, "Error reading from iterator "+fmt.Sprint(item.index))
+		}
+		heap.Pop(h)
+	} else {
+		h.items[0] = mergeItem{value: b, index: item.index}
+		heap.Fix(h, 0)
+	}
+	return item.value, item.index, nil
+}
+
+// Close closes every iterator.
+func (h *mergeHeap) Close() error {
+	for i, it := range h.iterators {
+		err := it.Close()
+		if err != nil {
+			return errors.Wrap(err, "Error closing iterator "+fmt.Sprint(i))
+		}
+	}
+	return nil
+}
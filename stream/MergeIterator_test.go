@@ -0,0 +1,55 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// newSortedStream returns a new closed stream with the objects, which must be sorted.
+func newSortedStream(t *testing.T, objects ...string) *Stream {
+	t.Helper()
+	s := newTestStream(t, "snappy", "memory", 2)
+	for _, object := range objects {
+		err := s.Append([]byte(object))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	return s
+}
+
+func TestMerge(t *testing.T) {
+	// Objects are ordered by their first byte, and the second byte identifies the stream.
+	less := func(a, b []byte) bool { return bytes.Compare(a[:1], b[:1]) < 0 }
+	a := newSortedStream(t, "a1", "c1", "e1")
+	b := newSortedStream(t, "b2", "c2", "d2")
+	c := newSortedStream(t, "a3", "f3")
+	empty := newSortedStream(t)
+	tests := []struct {
+		options  MergeOptions
+		expected string
+	}{
+		{MergeOptions{}, "[a1 a3 b2 c1 c2 d2 e1 f3]"},
+		{MergeOptions{Duplicates: DuplicatesKeepFirst}, "[a1 b2 c1 d2 e1 f3]"},
+		{MergeOptions{Duplicates: DuplicatesKeepLast}, "[a3 b2 c2 d2 e1 f3]"},
+		{MergeOptions{Reducer: func(x, y []byte) ([]byte, error) { return append(append([]byte{}, x...), y[1:]...), nil }}, "[a13 b2 c12 d2 e1 f3]"},
+	}
+	for _, test := range tests {
+		it, err := MergeWithOptions(less, test.options, a, empty, b, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objects := fmt.Sprint(readAll(t, it)); objects != test.expected {
+			t.Fatalf("expected %s but found %s", test.expected, objects)
+		}
+	}
+}
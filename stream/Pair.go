@@ -0,0 +1,43 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// EncodePair returns an object made of a key and a value.
+// The key is prefixed by its length as a uvarint, followed by the value.
+func EncodePair(key []byte, value []byte) []byte {
+	b := make([]byte, binary.MaxVarintLen64+len(key)+len(value))
+	n := binary.PutUvarint(b, uint64(len(key)))
+	n += copy(b[n:], key)
+	n += copy(b[n:], value)
+	return b[:n]
+}
+
+// DecodePair returns the key and value of an object encoded with EncodePair, and an error if any.
+func DecodePair(b []byte) ([]byte, []byte, error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < size {
+		return nil, nil, errors.New("Invalid pair.  Key length exceeds object length.")
+	}
+	return b[n : n+int(size)], b[n+int(size):], nil
+}
+
+// lessPairs returns true if the key of pair a is less than the key of pair b.
+func lessPairs(a []byte, b []byte) bool {
+	ka, _, _ := DecodePair(a)
+	kb, _, _ := DecodePair(b)
+	return bytes.Compare(ka, kb) < 0
+}
@@ -0,0 +1,153 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	PartitionHash       = "hash"        // objects are assigned by the hash of their key
+	PartitionRange      = "range"       // objects are assigned by comparing their key to split points sampled from the stream
+	PartitionRoundRobin = "round-robin" // objects are assigned to each partition in turn
+)
+
+// PartitionSampleSize is the number of keys sampled to choose the split points for range partitioning.
+var PartitionSampleSize = 1000
+
+// Partition splits the objects of the source stream into n new closed streams using the strategy: hash, range, or round-robin.
+// keyFn returns the key of an object.  If keyFn is nil, then the whole object is used as the key.
+// The new streams use the same algorithm, endianness, block size, block type, and temp directory as the source stream,
+// and rotate their buffers every BlockSize objects, so memory is bounded by n blocks.
+func Partition(src *Stream, n int, keyFn func(b []byte) []byte, strategy string) ([]*Stream, error) {
+
+	if n < 1 {
+		return nil, errors.New("Invalid number of partitions " + fmt.Sprint(n) + ".  Need at least 1 partition.")
+	}
+
+	if keyFn == nil {
+		keyFn = func(b []byte) []byte { return b }
+	}
+
+	var assign func(b []byte, i int) int
+	switch strategy {
+	case PartitionHash:
+		assign = func(b []byte, i int) int {
+			h := fnv.New32a()
+			h.Write(keyFn(b))
+			return int(h.Sum32() % uint32(n))
+		}
+	case PartitionRange:
+		splits, err := sampleSplits(src, n, keyFn)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error sampling split points")
+		}
+		assign = func(b []byte, i int) int {
+			key := keyFn(b)
+			return sort.Search(len(splits), func(j int) bool { return bytes.Compare(splits[j], key) > 0 })
+		}
+	case PartitionRoundRobin:
+		assign = func(b []byte, i int) int {
+			return i % n
+		}
+	default:
+		return nil, errors.New("Unknown partition strategy \"" + strategy + "\"")
+	}
+
+	partitions := make([]*Stream, 0, n)
+	for i := 0; i < n; i++ {
+		p, err := src.derive(src.BlockType, src.TempDir)
+		if err != nil {
+			removeAll(partitions)
+			return nil, errors.Wrap(err, "Error creating partition "+fmt.Sprint(i))
+		}
+		partitions = append(partitions, p)
+	}
+
+	it, err := src.open()
+	if err != nil {
+		removeAll(partitions)
+		return nil, errors.Wrap(err, "Error creating iterator for source stream")
+	}
+	if it != nil {
+		defer it.Close()
+		for i := 0; ; i++ {
+			b, err := it.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				removeAll(partitions)
+				return nil, errors.Wrap(err, "Error reading from source stream")
+			}
+			err = partitions[assign(b, i)].Append(b)
+			if err != nil {
+				removeAll(partitions)
+				return nil, errors.Wrap(err, "Error writing to partition")
+			}
+		}
+	}
+
+	for i, p := range partitions {
+		err := p.Close()
+		if err != nil {
+			removeAll(partitions)
+			return nil, errors.Wrap(err, "Error closing partition "+fmt.Sprint(i))
+		}
+	}
+
+	return partitions, nil
+}
+
+// sampleSplits returns n-1 split points chosen from a sample of the keys in the stream.
+func sampleSplits(src *Stream, n int, keyFn func(b []byte) []byte) ([][]byte, error) {
+
+	it, err := src.open()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating iterator for source stream")
+	}
+
+	sample := make([][]byte, 0, PartitionSampleSize)
+	if it != nil {
+		defer it.Close()
+		random := rand.New(rand.NewSource(0))
+		for i := 0; ; i++ {
+			b, err := it.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, errors.Wrap(err, "Error reading from source stream")
+			}
+			if len(sample) < PartitionSampleSize {
+				sample = append(sample, keyFn(b))
+			} else if j := random.Intn(i + 1); j < PartitionSampleSize {
+				sample[j] = keyFn(b)
+			}
+		}
+	}
+
+	sort.Slice(sample, func(i, j int) bool { return bytes.Compare(sample[i], sample[j]) < 0 })
+
+	splits := make([][]byte, 0, n-1)
+	if len(sample) > 0 {
+		for i := 1; i < n; i++ {
+			splits = append(splits, sample[i*len(sample)/n])
+		}
+	}
+	return splits, nil
+}
@@ -0,0 +1,95 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPartition(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 7)
+	for i := 0; i < 200; i++ {
+		err := s.Append([]byte(fmt.Sprintf("v%03d", (i*37)%200)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	for _, strategy := range []string{PartitionHash, PartitionRange, PartitionRoundRobin} {
+		partitions, err := Partition(s, 4, nil, strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(partitions) != 4 {
+			t.Fatalf("expected 4 partitions but found %d", len(partitions))
+		}
+		total := 0
+		last := ""
+		for i, p := range partitions {
+			objects := readStream(t, p)
+			total += len(objects)
+			switch strategy {
+			case PartitionRoundRobin:
+				if len(objects) != 50 {
+					t.Fatalf("expected 50 objects in partition %d but found %d", i, len(objects))
+				}
+			case PartitionRange:
+				// Every object of a partition is after every object of the previous partitions.
+				min := ""
+				max := ""
+				for _, object := range objects {
+					if min == "" || object < min {
+						min = object
+					}
+					if object > max {
+						max = object
+					}
+				}
+				if len(objects) > 0 && min <= last {
+					t.Fatalf("expected partition %d to begin after %q but found %q", i, last, min)
+				}
+				if len(objects) > 0 {
+					last = max
+				}
+			}
+		}
+		if total != 200 {
+			t.Fatal(strategy, total)
+		}
+	}
+}
+
+func TestPartitionHashKey(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 7)
+	for i := 0; i < 100; i++ {
+		err := s.Append([]byte(fmt.Sprintf("k%d-%03d", i%5, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	partitions, err := Partition(s, 3, func(b []byte) []byte { return b[:2] }, PartitionHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Objects with the same key are in the same partition.
+	owners := map[string]int{}
+	for i, p := range partitions {
+		for _, object := range readStream(t, p) {
+			key := object[:2]
+			if owner, ok := owners[key]; ok && owner != i {
+				t.Fatalf("key %s is in partitions %d and %d", key, owner, i)
+			}
+			owners[key] = i
+		}
+	}
+	if len(owners) != 5 {
+		t.Fatalf("expected 5 keys but found %d", len(owners))
+	}
+}
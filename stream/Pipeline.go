@@ -0,0 +1,347 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// funcIterator is an Iterator backed by functions.  It is used by the pipeline operators.
+type funcIterator struct {
+	next  func() ([]byte, error)
+	close func() error
+}
+
+func (it *funcIterator) Next() ([]byte, error) {
+	return it.next()
+}
+
+func (it *funcIterator) Close() error {
+	return it.close()
+}
+
+// Map returns an iterator that returns the result of fn for every object of the input iterator.
+// Closing the returned iterator closes the input iterator.
+func Map(it Iterator, fn func(b []byte) ([]byte, error)) Iterator {
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			b, err := it.Next()
+			if err != nil {
+				return b, err
+			}
+			return fn(b)
+		},
+		close: it.Close,
+	}
+}
+
+// mapResult is the result of fn for one object in MapConcurrent.
+type mapResult struct {
+	value []byte
+	err   error
+}
+
+// MapConcurrent returns an iterator like Map that calls fn for up to n objects at the same time.
+// The results are returned in the order of the input iterator.
+// Close does not wait for a pending read of the input iterator, such as a follow iterator waiting for new objects.
+// The input iterator is closed once that read returns.
+func MapConcurrent(it Iterator, fn func(b []byte) ([]byte, error), n int) Iterator {
+	if n <= 1 {
+		return Map(it, fn)
+	}
+
+	queue := make(chan chan mapResult, n)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		defer close(queue)
+		for {
+			b, err := it.Next()
+			result := make(chan mapResult, 1)
+			select {
+			case queue <- result:
+			case <-done:
+				return
+			}
+			if err != nil {
+				result <- mapResult{value: b, err: err}
+				return
+			}
+			go func() {
+				value, err := fn(b)
+				result <- mapResult{value: value, err: err}
+			}()
+		}
+	}()
+
+	var err error
+	once := &sync.Once{}
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			if err != nil {
+				return make([]byte, 0), err
+			}
+			result, ok := <-queue
+			if !ok {
+				err = io.EOF
+				return make([]byte, 0), err
+			}
+			r := <-result
+			if r.err != nil {
+				err = r.err
+			}
+			return r.value, r.err
+		},
+		close: func() error {
+			var closeErr error
+			once.Do(func() {
+				close(done)
+				select {
+				case <-finished:
+					closeErr = it.Close()
+				default:
+					go func() {
+						<-finished
+						it.Close()
+					}()
+				}
+			})
+			return closeErr
+		},
+	}
+}
+
+// Filter returns an iterator that returns only the objects of the input iterator for which fn returns true.
+func Filter(it Iterator, fn func(b []byte) (bool, error)) Iterator {
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			for {
+				b, err := it.Next()
+				if err != nil {
+					return b, err
+				}
+				ok, err := fn(b)
+				if err != nil {
+					return make([]byte, 0), err
+				}
+				if ok {
+					return b, nil
+				}
+			}
+		},
+		close: it.Close,
+	}
+}
+
+// FlatMap returns an iterator that returns every object returned by fn for every object of the input iterator.
+func FlatMap(it Iterator, fn func(b []byte) ([][]byte, error)) Iterator {
+	pending := make([][]byte, 0)
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			for len(pending) == 0 {
+				b, err := it.Next()
+				if err != nil {
+					return b, err
+				}
+				pending, err = fn(b)
+				if err != nil {
+					return make([]byte, 0), err
+				}
+			}
+			b := pending[0]
+			pending = pending[1:]
+			return b, nil
+		},
+		close: it.Close,
+	}
+}
+
+// Take returns an iterator that returns the first n objects of the input iterator and then io.EOF.
+func Take(it Iterator, n int) Iterator {
+	i := 0
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			if i >= n {
+				return make([]byte, 0), io.EOF
+			}
+			b, err := it.Next()
+			if err != nil {
+				return b, err
+			}
+			i += 1
+			return b, nil
+		},
+		close: it.Close,
+	}
+}
+
+// Skip returns an iterator that skips the first n objects of the input iterator.
+func Skip(it Iterator, n int) Iterator {
+	skipped := false
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			if !skipped {
+				skipped = true
+				for i := 0; i < n; i++ {
+					b, err := it.Next()
+					if err != nil {
+						return b, err
+					}
+				}
+			}
+			return it.Next()
+		},
+		close: it.Close,
+	}
+}
+
+// Batch returns an iterator that groups every n objects of the input iterator and returns the result of fn for each group.
+// The last group may have fewer than n objects.  If n is less than 1, then each group has 1 object.
+func Batch(it Iterator, n int, fn func(batch [][]byte) ([]byte, error)) Iterator {
+	if n < 1 {
+		n = 1
+	}
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			batch := make([][]byte, 0, n)
+			for len(batch) < n {
+				b, err := it.Next()
+				if err != nil {
+					if err == io.EOF && len(batch) > 0 {
+						break
+					}
+					return b, err
+				}
+				batch = append(batch, b)
+			}
+			return fn(batch)
+		},
+		close: it.Close,
+	}
+}
+
+// Window returns an iterator that returns the result of fn for every window of size objects of the input iterator,
+// starting a new window every step objects.  If step is equal to size, then the windows are tumbling windows.
+// Only complete windows are returned.
+func Window(it Iterator, size int, step int, fn func(window [][]byte) ([]byte, error)) (Iterator, error) {
+	if size < 1 || step < 1 {
+		return nil, errors.New("Invalid window size " + fmt.Sprint(size) + " or step " + fmt.Sprint(step) + ".  Both must be positive.")
+	}
+	window := make([][]byte, 0, size)
+	skip := 0
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			for len(window) < size {
+				b, err := it.Next()
+				if err != nil {
+					return b, err
+				}
+				if skip > 0 {
+					skip -= 1
+					continue
+				}
+				window = append(window, b)
+			}
+			b, err := fn(window)
+			if step < size {
+				window = append(make([][]byte, 0, size), window[step:]...)
+			} else {
+				skip = step - size
+				window = make([][]byte, 0, size)
+			}
+			return b, err
+		},
+		close: it.Close,
+	}, nil
+}
+
+// Tee returns n iterators that each return every object of the input iterator.
+// Objects read by one iterator are buffered in memory for the others until they read them.
+// The input iterator is closed once every returned iterator is closed.
+func Tee(it Iterator, n int) []Iterator {
+	mutex := &sync.Mutex{}
+	queues := make([][][]byte, n)
+	closed := make([]bool, n)
+	open := n
+	var last error
+
+	iterators := make([]Iterator, 0, n)
+	for i := 0; i < n; i++ {
+		i := i
+		iterators = append(iterators, &funcIterator{
+			next: func() ([]byte, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				if len(queues[i]) > 0 {
+					b := queues[i][0]
+					queues[i] = queues[i][1:]
+					return b, nil
+				}
+				if last != nil {
+					return make([]byte, 0), last
+				}
+				b, err := it.Next()
+				if err != nil {
+					last = err
+					return b, err
+				}
+				for j := range queues {
+					if j != i && !closed[j] {
+						queues[j] = append(queues[j], b)
+					}
+				}
+				return b, nil
+			},
+			close: func() error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				if closed[i] {
+					return nil
+				}
+				closed[i] = true
+				queues[i] = nil
+				open -= 1
+				if open == 0 {
+					return it.Close()
+				}
+				return nil
+			},
+		})
+	}
+	return iterators
+}
+
+// Sink writes every object of the iterator to the stream with Append, rotating the buffer every BlockSize objects,
+// and then closes the iterator.  Returns the number of objects written, and an error if any.
+// The stream is not closed.
+func Sink(it Iterator, s *Stream) (int, error) {
+	defer it.Close()
+	n := 0
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, errors.Wrap(err, "Error reading from iterator")
+		}
+		err = s.Append(b)
+		if err != nil {
+			return n, errors.Wrap(err, "Error writing to stream")
+		}
+		n += 1
+	}
+}
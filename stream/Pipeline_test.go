@@ -0,0 +1,86 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 50)
+	s.Close()
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Iterator = MapConcurrent(it, func(b []byte) ([]byte, error) { return append([]byte("x"), b...), nil }, 4)
+	p = Filter(p, func(b []byte) (bool, error) { return b[5]%2 == 0, nil })
+	p = Skip(p, 2)
+	p = Take(p, 10)
+	p = FlatMap(p, func(b []byte) ([][]byte, error) { return [][]byte{b, b}, nil })
+	p = Batch(p, 3, func(b [][]byte) ([]byte, error) { return bytes.Join(b, []byte(",")), nil })
+	tee := Tee(p, 2)
+	out := newTestStream(t, "snappy", "memory", 3)
+	n, err := Sink(tee[0], out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := readAll(t, tee[1])
+	if n != 7 || len(objects) != 7 || objects[0] != "xr0004,xr0004,xr0006" {
+		t.Fatal(n, objects)
+	}
+}
+
+func TestPipelineWindow(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 50)
+	s.Close()
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := Window(it, 3, 2, func(b [][]byte) ([]byte, error) { return bytes.Join(b, nil), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := readAll(t, w)
+	if len(objects) != 24 || objects[1] != "r0002r0003r0004" {
+		t.Fatal(objects)
+	}
+}
+
+func TestMapConcurrentCloseFollow(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 5)
+	s.Rotate()
+	m := MapConcurrent(s.Follow(context.Background()), func(b []byte) ([]byte, error) { return b, nil }, 4)
+	for i := 0; i < 5; i++ {
+		b, err := m.Next()
+		if err != nil || string(b) != testRecord(i) {
+			t.Fatal(string(b), err)
+		}
+	}
+	// The follow iterator is waiting for new objects, so Close must not wait for it.
+	closed := make(chan error, 1)
+	go func() {
+		closed <- m.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return while the input iterator was blocked")
+	}
+	s.Close()
+}
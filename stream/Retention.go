@@ -0,0 +1,141 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"time"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Evict removes the oldest blocks of the stream while it exceeds MaxRecords, MaxBytes, or MaxAge, and returns an error if any.
+// Blocks are evicted automatically when the buffer is rotated and when blocks are appended,
+// so Evict only needs to be called to enforce MaxAge on a stream that is not being written to.
+func (s *Stream) Evict() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n, err := s.evict()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.notify()
+	}
+	return nil
+}
+
+// evict removes the oldest blocks while the stream exceeds MaxRecords, MaxBytes, or MaxAge,
+// and returns the number of blocks evicted.  Blocks are evicted whole, so the stream may hold less than a limit.
+// The number of objects and bytes of the blocks are kept as running totals, so the blocks are only measured once.
+// Iterators opened before the eviction keep reading the evicted blocks, which are removed once those iterators are closed.
+// The caller must hold the stream's mutex.
+func (s *Stream) evict() (int, error) {
+	if s.MaxRecords <= 0 && s.MaxBytes <= 0 && s.MaxAge <= 0 {
+		return 0, nil
+	}
+
+	if s.totals == nil {
+		s.totals = map[Block]blockTotal{}
+		s.records = 0
+		s.bytes = 0
+		for _, block := range s.Blocks {
+			err := s.measure(block)
+			if err != nil {
+				s.totals = nil
+				return 0, err
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-s.MaxAge)
+	records := s.records
+	size := s.bytes
+	n := 0
+	for n < len(s.Blocks) {
+		expired := (s.MaxRecords > 0 && records > s.MaxRecords) ||
+			(s.MaxBytes > 0 && size > s.MaxBytes) ||
+			(s.MaxAge > 0 && s.Blocks[n].GetCreated().Before(cutoff))
+		if !expired {
+			break
+		}
+		total := s.totals[s.Blocks[n]]
+		records -= total.count
+		size -= total.size
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	evicted := s.Blocks[:n]
+	s.Blocks = append(make([]Block, 0, len(s.Blocks)-n), s.Blocks[n:]...)
+	s.untrack(evicted)
+	s.retire(evicted)
+	for _, idx := range s.Indexes {
+		idx.evict(evicted)
+	}
+	// Cursors moved into an evicted block by Compact no longer resolve.
+	ids := make([]int, 0, n)
+	for _, block := range evicted {
+		ids = append(ids, block.GetID())
+	}
+	s.unmove(ids)
+	return n, nil
+}
+
+// blockTotal is the number of objects and compressed bytes of a block.
+type blockTotal struct {
+	count int
+	size  int64
+}
+
+// measure adds the block to the running totals of retention.  The caller must hold the stream's mutex.
+func (s *Stream) measure(block Block) error {
+	count, err := countObjects(block)
+	if err != nil {
+		return errors.Wrap(err, "Error counting objects in block "+fmt.Sprint(block.GetID()))
+	}
+	size, err := block.Size()
+	if err != nil {
+		return errors.Wrap(err, "Error calculating size for block "+fmt.Sprint(block.GetID()))
+	}
+	s.totals[block] = blockTotal{count: count, size: size}
+	s.records += count
+	s.bytes += size
+	return nil
+}
+
+// track adds the blocks added to Blocks to the running totals of retention, if the totals are kept.
+// If a block cannot be measured, then the totals are dropped, so the next eviction measures every block and returns the error.
+// The caller must hold the stream's mutex.
+func (s *Stream) track(blocks []Block) {
+	if s.totals == nil {
+		return
+	}
+	for _, block := range blocks {
+		err := s.measure(block)
+		if err != nil {
+			s.totals = nil
+			return
+		}
+	}
+}
+
+// untrack removes the blocks removed from Blocks from the running totals of retention.  The caller must hold the stream's mutex.
+func (s *Stream) untrack(blocks []Block) {
+	for _, block := range blocks {
+		if total, ok := s.totals[block]; ok {
+			s.records -= total.count
+			s.bytes -= total.size
+			delete(s.totals, block)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRetentionMaxRecords(t *testing.T) {
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxRecords = 25
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddIndex("all", func(b []byte) []byte { return []byte("x") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 0, 30)
+	before, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 30, 60)
+	expectRecords(t, readStream(t, s), 40, 60)
+	// The iterator opened before the eviction keeps reading the evicted blocks.
+	expectRecords(t, readAll(t, before), 10, 30)
+	objects, err := s.GetByIndex("all", []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 20 || len(s.Indexes["all"].Stream.Blocks) != 2 {
+		t.Fatal(len(objects), len(s.Indexes["all"].Stream.Blocks))
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 30)
+	s.MaxAge = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	err := s.Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Blocks) != 0 {
+		t.Fatalf("expected no blocks but found %d", len(s.Blocks))
+	}
+}
+
+func TestRetentionMaxBytes(t *testing.T) {
+	for _, blockType := range []string{"memory", "file"} {
+		before, _ := ioutil.ReadDir("/proc/self/fd")
+		s, err := New("none", "little", 10, blockType, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.MaxBytes = 300
+		err = s.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendRecords(t, s, 0, 200)
+		size := int64(0)
+		for _, block := range s.Blocks {
+			n, err := block.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+			size += n
+		}
+		if size > 300 || size != s.bytes {
+			t.Fatalf("expected at most 300 bytes but found %d, with a running total of %d", size, s.bytes)
+		}
+		if after, err := ioutil.ReadDir("/proc/self/fd"); err == nil && len(after) > len(before)+10 {
+			t.Fatalf("expected about %d open files but found %d", len(before), len(after))
+		}
+		s.Close()
+	}
+}
+
+func TestRetentionTotals(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 5)
+	s.MaxRecords = 1000
+	appendRecords(t, s, 0, 100)
+	err := s.Compact(20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 100, 200)
+	err = s.Transcode("gzip", "memory", TranscodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(readStream(t, s)); s.records != n {
+		t.Fatalf("expected a running total of %d objects but found %d", n, s.records)
+	}
+	s.MaxRecords = 50
+	err = s.Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := readStream(t, s)
+	if len(objects) > 50 || s.records != len(objects) {
+		t.Fatalf("expected at most 50 objects but found %d, with a running total of %d", len(objects), s.records)
+	}
+	expectRecords(t, objects, 200-len(objects), 200)
+}
+
+func TestRetentionFollowIterator(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 30)
+	it := s.Follow(context.Background())
+	defer it.Close()
+	for i := 0; i < 5; i++ {
+		b, err := it.Next()
+		if err != nil || string(b) != testRecord(i) {
+			t.Fatal(string(b), err)
+		}
+	}
+	s.MaxRecords = 10
+	appendRecords(t, s, 30, 40)
+	// The follower finishes the block it is reading and then skips ahead to the oldest block left.
+	s.Close()
+	objects := readAll(t, it)
+	expectRecords(t, objects[:5], 5, 10)
+	expectRecords(t, objects[5:], 30, 40)
+}
+
+// newEvictingStream returns a new stream of 20 objects in file blocks of 2 objects,
+// and a function that arms the stream to evict its 3 oldest blocks the next time its blocks are rewritten.
+func newEvictingStream(t *testing.T) (*Stream, func()) {
+	t.Helper()
+	s, err := New("snappy", "little", 2, "file", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	armed := false
+	// The key function is called while blocks are rewritten, without holding the stream's mutex.
+	s.KeyFunc = func(b []byte) []byte {
+		if armed {
+			armed = false
+			s.MaxRecords = 15
+			err := s.Evict()
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		return b
+	}
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 0, 20)
+	return s, func() { armed = true }
+}
+
+func TestRetentionCompact(t *testing.T) {
+	s, arm := newEvictingStream(t)
+	_, err := s.AddIndex("record", func(b []byte) []byte { return b })
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm()
+	err = s.Compact(4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		objects, err := s.GetByIndex("record", []byte(testRecord(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(objects) == 1) != (i >= 6) {
+			t.Fatalf("expected record %d to be indexed only if it was not evicted, but found %d objects", i, len(objects))
+		}
+	}
+	// The first group was evicted, and the second group kept the block that was not evicted.
+	if len(s.Blocks) != 4 || s.Blocks[0].GetCount() != 2 || s.Blocks[1].GetCount() != 4 {
+		t.Fatalf("expected a block of 2 objects followed by blocks of 4 objects but found %d blocks", len(s.Blocks))
+	}
+	expectRecords(t, readStream(t, s), 6, 20)
+	// The index entries of the replacements that were removed are removed too.
+	files := len(s.Blocks) + len(s.Indexes["record"].Stream.Blocks)
+	if n := countFiles(t, s.TempDir); n != files {
+		t.Fatalf("expected %d files but found %d", files, n)
+	}
+}
+
+func TestRetentionTranscode(t *testing.T) {
+	s, arm := newEvictingStream(t)
+	arm()
+	err := s.Transcode("gzip", "file", TranscodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Blocks) != 7 {
+		t.Fatalf("expected 7 blocks but found %d", len(s.Blocks))
+	}
+	for _, block := range s.Blocks {
+		if block.(*TempFileBlock).GetAlgorithm() != "gzip" {
+			t.Fatalf("expected gzip blocks but found %s", block.(*TempFileBlock).GetAlgorithm())
+		}
+	}
+	expectRecords(t, readStream(t, s), 6, 20)
+	if n := countFiles(t, s.TempDir); n != len(s.Blocks) {
+		t.Fatalf("expected %d files but found %d", len(s.Blocks), n)
+	}
+}
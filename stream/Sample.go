@@ -0,0 +1,199 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Sample returns a uniform random sample of up to k objects from the stream using the seed.
+// If the number of objects in every block is known, then only the blocks holding sampled positions are read,
+// and each of them only up to the last sampled position.  Otherwise, reservoir sampling is used over the whole stream.
+// The sampled objects are returned in stream order.
+func Sample(s *Stream, k int, seed int64) ([][]byte, error) {
+
+	if k < 0 {
+		return nil, errors.New("Invalid sample size " + fmt.Sprint(k) + ".  Sample size cannot be negative.")
+	}
+
+	s.mutex.Lock()
+	blocks := s.Blocks
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	defer s.release(blocks)
+
+	total := 0
+	for _, block := range blocks {
+		count := block.GetCount()
+		if count < 0 {
+			it, err := s.open()
+			if err != nil {
+				return nil, errors.Wrap(err, "Error creating iterator for stream")
+			}
+			if it == nil {
+				return make([][]byte, 0), nil
+			}
+			return SampleIterator(it, k, seed)
+		}
+		total += count
+	}
+
+	if k > total {
+		k = total
+	}
+
+	positions := samplePositions(rand.New(rand.NewSource(seed)), total, k)
+
+	sample := make([][]byte, 0, k)
+	offset := 0
+	p := 0
+	for i, block := range blocks {
+		count := block.GetCount()
+		if p < len(positions) && positions[p] < offset+count {
+			it, err := block.Iterator()
+			if err != nil {
+				return nil, errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(i))
+			}
+			for j := 0; p < len(positions) && positions[p] < offset+count; j++ {
+				b, err := it.Next()
+				if err != nil {
+					it.Close()
+					return nil, errors.Wrap(err, "Error reading block "+fmt.Sprint(i))
+				}
+				if positions[p] == offset+j {
+					sample = append(sample, b)
+					p += 1
+				}
+			}
+			it.Close()
+		}
+		offset += count
+	}
+
+	return sample, nil
+}
+
+// samplePositions returns k distinct positions in [0, n) chosen uniformly at random, in ascending order.
+// It uses Floyd's algorithm, so memory is proportional to k rather than n.
+func samplePositions(random *rand.Rand, n int, k int) []int {
+	chosen := make(map[int]struct{}, k)
+	for j := n - k; j < n; j++ {
+		p := random.Intn(j + 1)
+		if _, ok := chosen[p]; ok {
+			p = j
+		}
+		chosen[p] = struct{}{}
+	}
+	positions := make([]int, 0, k)
+	for p := range chosen {
+		positions = append(positions, p)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// SampleIterator returns a uniform random sample of up to k objects from the iterator using reservoir sampling.
+// The iterator is read to the end and closed.  The sampled objects are returned in iterator order.
+func SampleIterator(it Iterator, k int, seed int64) ([][]byte, error) {
+	defer it.Close()
+
+	random := rand.New(rand.NewSource(seed))
+	reservoir := newReservoir(k)
+	for i := 0; ; i++ {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "Error reading from iterator")
+		}
+		reservoir.Add(b, i, random)
+	}
+
+	return reservoir.Objects(), nil
+}
+
+// SampleStratified returns a uniform random sample of up to k objects for each key from the iterator using the seed.
+// keyFn returns the stratum of an object.  The iterator is read to the end and closed.
+func SampleStratified(it Iterator, k int, seed int64, keyFn func(b []byte) string) (map[string][][]byte, error) {
+	defer it.Close()
+
+	random := rand.New(rand.NewSource(seed))
+	reservoirs := map[string]*reservoir{}
+	for i := 0; ; i++ {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "Error reading from iterator")
+		}
+		key := keyFn(b)
+		r, ok := reservoirs[key]
+		if !ok {
+			r = newReservoir(k)
+			reservoirs[key] = r
+		}
+		r.Add(b, r.seen, random)
+	}
+
+	samples := map[string][][]byte{}
+	for key, r := range reservoirs {
+		samples[key] = r.Objects()
+	}
+	return samples, nil
+}
+
+// reservoir is a fixed-size uniform random sample of the objects added to it.
+type reservoir struct {
+	size      int
+	seen      int
+	objects   [][]byte
+	positions []int
+}
+
+func newReservoir(size int) *reservoir {
+	return &reservoir{
+		size:      size,
+		objects:   make([][]byte, 0, size),
+		positions: make([]int, 0, size),
+	}
+}
+
+// Add considers the object at the given position for the sample.
+func (r *reservoir) Add(b []byte, position int, random *rand.Rand) {
+	if len(r.objects) < r.size {
+		r.objects = append(r.objects, b)
+		r.positions = append(r.positions, position)
+	} else if j := random.Intn(r.seen + 1); j < r.size {
+		r.objects[j] = b
+		r.positions[j] = position
+	}
+	r.seen += 1
+}
+
+// Objects returns the sampled objects in the order they were added.
+func (r *reservoir) Objects() [][]byte {
+	indices := make([]int, len(r.objects))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.Slice(indices, func(i, j int) bool { return r.positions[indices[i]] < r.positions[indices[j]] })
+	objects := make([][]byte, 0, len(indices))
+	for _, i := range indices {
+		objects = append(objects, r.objects[i])
+	}
+	return objects
+}
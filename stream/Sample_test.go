@@ -0,0 +1,110 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// expectSample fails the test unless the sample has k distinct objects of the stream in stream order.
+func expectSample(t *testing.T, sample [][]byte, k int) {
+	t.Helper()
+	if len(sample) != k {
+		t.Fatalf("expected %d objects but found %d", k, len(sample))
+	}
+	for i := 1; i < len(sample); i++ {
+		if string(sample[i]) <= string(sample[i-1]) {
+			t.Fatalf("expected objects in stream order but found %q after %q", sample[i], sample[i-1])
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 95)
+	s.Close()
+	sample, err := Sample(s, 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSample(t, sample, 7)
+	again, err := Sample(s, 7, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sample {
+		if string(sample[i]) != string(again[i]) {
+			t.Fatal("expected the same sample for the same seed")
+		}
+	}
+	all, err := Sample(s, 200, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSample(t, all, 95)
+}
+
+func TestSampleUnknownCount(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 10)
+	s.Close()
+	// Blocks appended from bytes have an unknown count, so the whole stream is sampled with a reservoir.
+	err := s.AppendBlock(s.Blocks[0].(*MemoryBlock).Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample, err := Sample(s, 7, 1)
+	if err != nil || len(sample) != 7 {
+		t.Fatal(sample, err)
+	}
+}
+
+func TestSamplePositions(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	hits := make([]int, 10)
+	for i := 0; i < 2000; i++ {
+		positions := samplePositions(random, 10, 3)
+		if len(positions) != 3 {
+			t.Fatal(positions)
+		}
+		for j, p := range positions {
+			if p < 0 || p >= 10 || (j > 0 && p <= positions[j-1]) {
+				t.Fatal(positions)
+			}
+			hits[p] += 1
+		}
+	}
+	// Each position is expected to be sampled 600 times.
+	for p, n := range hits {
+		if n < 450 || n > 750 {
+			t.Fatalf("position %d sampled %d times", p, n)
+		}
+	}
+	positions := samplePositions(random, 1<<30, 5)
+	if len(positions) != 5 {
+		t.Fatal(positions)
+	}
+}
+
+func TestSampleStratified(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 95)
+	s.Close()
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := SampleStratified(it, 2, 1, func(b []byte) string { return string(b[1:4]) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 10 || len(samples["000"]) != 2 || len(samples["009"]) != 2 {
+		t.Fatal(samples)
+	}
+}
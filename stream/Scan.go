@@ -0,0 +1,93 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Scan returns an iterator over the objects in the stream whose key, returned by KeyFunc, matches the predicate.
+// Blocks with statistics that rule out a match are skipped without being read.
+// Blocks without statistics, such as blocks added with AppendBlock, are always read.
+func (s *Stream) Scan(predicate Predicate) (Iterator, error) {
+	if s.KeyFunc == nil {
+		return nil, errors.New("Error scanning stream.  KeyFunc is nil.")
+	}
+	keyFn := s.KeyFunc
+	return s.scan(func(block Block) bool {
+		stats := block.GetStats()
+		return stats == nil || predicate.MayMatch(stats)
+	}, func(b []byte) bool {
+		return predicate.Match(keyFn(b))
+	}), nil
+}
+
+// scan returns an iterator over the objects in the blocks accepted by include that are accepted by match.
+// The iterator holds a snapshot of the stream's blocks until it is closed.
+func (s *Stream) scan(include func(block Block) bool, match func(b []byte) bool) Iterator {
+	s.mutex.Lock()
+	snapshot := s.Blocks
+	s.acquire(snapshot)
+	s.mutex.Unlock()
+
+	blocks := make([]Block, 0)
+	for _, block := range snapshot {
+		if include(block) {
+			blocks = append(blocks, block)
+		}
+	}
+
+	var current *BlockIterator
+	released := false
+	return &funcIterator{
+		next: func() ([]byte, error) {
+			for {
+				if current == nil {
+					if len(blocks) == 0 {
+						return make([]byte, 0), io.EOF
+					}
+					it, err := blocks[0].Iterator()
+					if err != nil {
+						return make([]byte, 0), errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(blocks[0].GetID()))
+					}
+					current = it
+					blocks = blocks[1:]
+				}
+				b, err := current.Next()
+				if err != nil {
+					if err != io.EOF {
+						return b, err
+					}
+					current.Close()
+					current = nil
+					continue
+				}
+				if match(b) {
+					return b, nil
+				}
+			}
+		},
+		close: func() error {
+			if !released {
+				released = true
+				defer s.release(snapshot)
+			}
+			if current != nil {
+				err := current.Close()
+				current = nil
+				return err
+			}
+			return nil
+		},
+	}
+}
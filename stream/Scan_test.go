@@ -0,0 +1,91 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newKeyedStream returns a new closed stream of n objects whose key is the first 3 bytes, written in key order.
+func newKeyedStream(t *testing.T, n int) *Stream {
+	t.Helper()
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.KeyFunc = func(b []byte) []byte { return b[:3] }
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err := s.Append([]byte(fmt.Sprintf("%03d-x", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	return s
+}
+
+func TestBlockStats(t *testing.T) {
+	s := newKeyedStream(t, 100)
+	stats := s.Blocks[2].GetStats()
+	if stats == nil || string(stats.MinKey) != "020" || string(stats.MaxKey) != "029" || stats.Count != 10 {
+		t.Fatal(stats)
+	}
+	// Compacted blocks have the statistics of all of their objects.
+	err := s.Compact(30, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = s.Blocks[0].GetStats()
+	if stats == nil || string(stats.MinKey) != "000" || string(stats.MaxKey) != "029" || stats.Count != 30 {
+		t.Fatal(stats)
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := newKeyedStream(t, 100)
+	it, err := s.Scan(KeyRange{Min: []byte("025"), Max: []byte("031")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := readAll(t, it)
+	if len(objects) != 7 || objects[0] != "025-x" || objects[6] != "031-x" {
+		t.Fatal(objects)
+	}
+	it, err = s.Scan(KeyEquals([]byte("042")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects = readAll(t, it)
+	if len(objects) != 1 || objects[0] != "042-x" {
+		t.Fatal(objects)
+	}
+}
+
+func TestKeyRangeMayMatch(t *testing.T) {
+	stats := &BlockStats{MinKey: []byte("020"), MaxKey: []byte("029"), Count: 10}
+	tests := []struct {
+		predicate KeyRange
+		expected  bool
+	}{
+		{KeyRange{Min: []byte("025"), Max: []byte("031")}, true},
+		{KeyRange{Min: []byte("030"), Max: []byte("039")}, false},
+		{KeyRange{Max: []byte("019")}, false},
+		{KeyRange{Min: []byte("029")}, true},
+		{KeyEquals([]byte("020")), true},
+	}
+	for _, test := range tests {
+		if test.predicate.MayMatch(stats) != test.expected {
+			t.Fatalf("expected MayMatch of %s to %s to be %v", test.predicate.Min, test.predicate.Max, test.expected)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+//go:build go1.23
+// +build go1.23
+
+package stream
+
+import (
+	"io"
+	"iter"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Seq returns a sequence of the objects returned by the iterator for use with range-over-func.
+// The iterator is closed when the sequence ends, including when the loop breaks early.
+// If an error occurs, the sequence yields the error once and stops.
+func Seq(it Iterator) iter.Seq2[[]byte, error] {
+	return seq(func() (Iterator, error) { return it, nil }, 0, -1)
+}
+
+// seq returns a sequence of the objects in the iterator created by open, from position start up to but excluding end.
+// If end is negative, then the sequence continues until the end of the iterator.
+// If open returns a nil iterator, then the sequence is empty.
+func seq(open func() (Iterator, error), start int, end int) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		it, err := open()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if it == nil {
+			return
+		}
+		defer it.Close()
+		for i := 0; end < 0 || i < end; i++ {
+			b, err := it.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if i < start {
+				continue
+			}
+			if !yield(b, nil) {
+				return
+			}
+		}
+	}
+}
+
+// backward returns a sequence of the objects in the blocks in reverse order.
+// Each block is read into memory one at a time.
+func backward(blocks []Block) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for i := len(blocks) - 1; i >= 0; i-- {
+			objects := make([][]byte, 0)
+			block := blocks[i]
+			for b, err := range seq(func() (Iterator, error) { return block.Iterator() }, 0, -1) {
+				if err != nil {
+					yield(nil, errors.Wrap(err, "Error reading block"))
+					return
+				}
+				objects = append(objects, b)
+			}
+			for j := len(objects) - 1; j >= 0; j-- {
+				if !yield(objects[j], nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// All returns a sequence of every object in the stream.
+func (s *Stream) All() iter.Seq2[[]byte, error] {
+	return s.Range(0, -1)
+}
+
+// Range returns a sequence of the objects in the stream from position start up to but excluding end.
+// If end is negative, then the sequence continues until the end of the stream.
+func (s *Stream) Range(start int, end int) iter.Seq2[[]byte, error] {
+	return seq(func() (Iterator, error) {
+		it, err := s.open()
+		if err != nil || it == nil {
+			return nil, err
+		}
+		return it, nil
+	}, start, end)
+}
+
+// Backward returns a sequence of every object in the stream in reverse order.
+// Each block is read into memory one at a time.
+func (s *Stream) Backward() iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		s.mutex.Lock()
+		blocks := s.Blocks
+		s.acquire(blocks)
+		s.mutex.Unlock()
+		defer s.release(blocks)
+		backward(blocks)(yield)
+	}
+}
+
+// All returns a sequence of every object in the block.
+func (mb *MemoryBlock) All() iter.Seq2[[]byte, error] {
+	return mb.Range(0, -1)
+}
+
+// Range returns a sequence of the objects in the block from position start up to but excluding end.
+func (mb *MemoryBlock) Range(start int, end int) iter.Seq2[[]byte, error] {
+	return seq(func() (Iterator, error) { return mb.Iterator() }, start, end)
+}
+
+// Backward returns a sequence of every object in the block in reverse order.
+func (mb *MemoryBlock) Backward() iter.Seq2[[]byte, error] {
+	return backward([]Block{mb})
+}
+
+// All returns a sequence of every object in the block.
+func (tfb *TempFileBlock) All() iter.Seq2[[]byte, error] {
+	return tfb.Range(0, -1)
+}
+
+// Range returns a sequence of the objects in the block from position start up to but excluding end.
+func (tfb *TempFileBlock) Range(start int, end int) iter.Seq2[[]byte, error] {
+	return seq(func() (Iterator, error) { return tfb.Iterator() }, start, end)
+}
+
+// Backward returns a sequence of every object in the block in reverse order.
+func (tfb *TempFileBlock) Backward() iter.Seq2[[]byte, error] {
+	return backward([]Block{tfb})
+}
+
+// All returns a sequence of every object in the block.
+func (cb *ColumnarBlock) All() iter.Seq2[[]byte, error] {
+	return cb.Range(0, -1)
+}
+
+// Range returns a sequence of the objects in the block from position start up to but excluding end.
+func (cb *ColumnarBlock) Range(start int, end int) iter.Seq2[[]byte, error] {
+	return seq(func() (Iterator, error) { return cb.Iterator() }, start, end)
+}
+
+// Backward returns a sequence of every object in the block in reverse order.
+func (cb *ColumnarBlock) Backward() iter.Seq2[[]byte, error] {
+	return backward([]Block{cb})
+}
+
+// All returns a sequence of every object in the block.
+func (cb *ContentBlock) All() iter.Seq2[[]byte, error] {
+	return cb.Range(0, -1)
+}
+
+// Range returns a sequence of the objects in the block from position start up to but excluding end.
+func (cb *ContentBlock) Range(start int, end int) iter.Seq2[[]byte, error] {
+	return seq(func() (Iterator, error) { return cb.Iterator() }, start, end)
+}
+
+// Backward returns a sequence of every object in the block in reverse order.
+func (cb *ContentBlock) Backward() iter.Seq2[[]byte, error] {
+	return backward([]Block{cb})
+}
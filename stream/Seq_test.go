@@ -0,0 +1,205 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"io/ioutil"
+	"iter"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamAll(t *testing.T) {
+	for _, blockType := range []string{"memory", "file"} {
+		s := newTestStream(t, "snappy", blockType, 10)
+		appendRecords(t, s, 0, 25)
+		s.Close()
+		objects := make([]string, 0)
+		for b, err := range s.All() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			objects = append(objects, string(b))
+		}
+		expectRecords(t, objects, 0, 25)
+	}
+}
+
+func TestStreamRange(t *testing.T) {
+	s := newTestStream(t, "snappy", "file", 10)
+	appendRecords(t, s, 0, 25)
+	s.Close()
+	objects := make([]string, 0)
+	for b, err := range s.Range(8, 12) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+	}
+	expectRecords(t, objects, 8, 12)
+}
+
+func TestStreamBackward(t *testing.T) {
+	s := newTestStream(t, "gzip", "memory", 10)
+	appendRecords(t, s, 0, 25)
+	s.Close()
+	objects := make([]string, 0)
+	for b, err := range s.Backward() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+		if len(objects) == 12 {
+			break
+		}
+	}
+	for i, object := range objects {
+		if object != testRecord(24-i) {
+			t.Fatalf("expected %q at position %d but found %q", testRecord(24-i), i, object)
+		}
+	}
+}
+
+func TestStreamAllEmpty(t *testing.T) {
+	s, err := New("none", "little", 10, "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range s.All() {
+		t.Fatal("expected no objects")
+	}
+}
+
+func TestBlockAll(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 10)
+	s.Close()
+	mb := s.Blocks[0].(*MemoryBlock)
+	objects := make([]string, 0)
+	for b, err := range mb.Range(2, 5) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+	}
+	expectRecords(t, objects, 2, 5)
+	n := 0
+	for _, err := range mb.Backward() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += 1
+	}
+	if n != 10 {
+		t.Fatalf("expected 10 objects but found %d", n)
+	}
+}
+
+// openFiles returns the set of files the test process has open.
+func openFiles(t *testing.T) map[string]bool {
+	t.Helper()
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files are not listed at /proc/self/fd")
+	}
+	files := map[string]bool{}
+	for _, fd := range fds {
+		name, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if err == nil {
+			files[name] = true
+		}
+	}
+	return files
+}
+
+func TestStreamSeqBreak(t *testing.T) {
+	s := newTestStream(t, "snappy", "file", 10)
+	appendRecords(t, s, 0, 25)
+	s.Close()
+	sequences := map[string]func() iter.Seq2[[]byte, error]{
+		"All":      s.All,
+		"Range":    func() iter.Seq2[[]byte, error] { return s.Range(2, 20) },
+		"Backward": s.Backward,
+		"Block":    s.Blocks[0].(*TempFileBlock).All,
+	}
+	for name, sequence := range sequences {
+		n := 0
+		for _, err := range sequence() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += 1
+			if n == 3 {
+				break
+			}
+		}
+		s.mutex.Lock()
+		refs := len(s.refs)
+		s.mutex.Unlock()
+		if refs != 0 {
+			t.Fatalf("%s: expected the snapshot to be released but %d blocks are still referenced", name, refs)
+		}
+		files := openFiles(t)
+		for _, block := range s.Blocks {
+			if tempFile := block.(*TempFileBlock).TempFile; files[tempFile] {
+				t.Fatalf("%s: expected the file block at %q to be closed", name, tempFile)
+			}
+		}
+	}
+}
+
+func TestColumnarBlockAll(t *testing.T) {
+	s := newColumnarStream(t, "snappy", 10)
+	cb := s.Blocks[0].(*ColumnarBlock)
+	objects := make([]string, 0)
+	for b, err := range cb.Range(2, 5) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+	}
+	if len(objects) != 3 || objects[0] != csvRecord(2) || objects[2] != csvRecord(4) {
+		t.Fatalf("expected records 2 to 5 but found %q", objects)
+	}
+	objects = objects[:0]
+	for b, err := range cb.Backward() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+	}
+	if len(objects) != 10 || objects[0] != csvRecord(9) || objects[9] != csvRecord(0) {
+		t.Fatalf("expected records 9 to 0 but found %q", objects)
+	}
+}
+
+func TestContentBlockAll(t *testing.T) {
+	s := newStoreStream(t, NewMemoryBlockStore())
+	cb := s.Blocks[0].(*ContentBlock)
+	n := 0
+	for b, err := range cb.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "ref" {
+			t.Fatalf("expected %q but found %q", "ref", b)
+		}
+		n += 1
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 objects but found %d", n)
+	}
+	n = 0
+	for range cb.Backward() {
+		n += 1
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 objects but found %d", n)
+	}
+}
@@ -0,0 +1,198 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"io"
+	"sort"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DefaultMemoryBudget is the default number of bytes of objects held in memory by operations that spill to disk.
+var DefaultMemoryBudget = int64(64 * 1024 * 1024)
+
+// SortOptions are the options for Sort.
+type SortOptions struct {
+	MemoryBudget int64  // the maximum number of bytes of objects sorted in memory.  Defaults to DefaultMemoryBudget.
+	TempDir      string // the directory for sorted runs spilled to disk and file blocks of the sorted stream.  Defaults to the source stream's TempDir.
+	BlockType    string // the block type of the sorted stream.  Defaults to the source stream's block type.
+}
+
+// Sort returns a new closed stream with the objects of the source stream sorted by less.
+// Chunks of objects are sorted in memory under the memory budget and spilled as sorted runs into temp file blocks,
+// which are then merged into the new stream.  The sort is stable.
+// The new stream uses the same algorithm, endianness, and block size as the source stream,
+// and the block type and temp directory of the options, which default to those of the source stream.
+func Sort(src *Stream, less func(a, b []byte) bool, options SortOptions) (*Stream, error) {
+
+	blockType := options.BlockType
+	if blockType == "" {
+		blockType = src.BlockType
+	}
+	tempDir := options.TempDir
+	if tempDir == "" {
+		tempDir = src.TempDir
+	}
+
+	out, err := src.derive(blockType, tempDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating output stream")
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			out.Close()
+			out.Remove()
+		}
+	}()
+
+	runs, err := sortRuns(src, less, options, out)
+	if err != nil {
+		return nil, err
+	}
+	defer removeAll(runs)
+
+	if len(runs) > 0 {
+		err = mergeInto(out, less, runs)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error merging sorted runs")
+		}
+	}
+
+	err = out.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error closing output stream")
+	}
+
+	succeeded = true
+	return out, nil
+}
+
+// sortRuns reads the source stream in chunks under the memory budget and sorts each chunk.
+// If every object fits in one chunk, then the chunk is written to out and no runs are returned.
+// Otherwise, returns the sorted runs as closed streams of temp file blocks.
+func sortRuns(src *Stream, less func(a, b []byte) bool, options SortOptions, out *Stream) ([]*Stream, error) {
+
+	budget := options.MemoryBudget
+	if budget <= 0 {
+		budget = DefaultMemoryBudget
+	}
+	tempDir := options.TempDir
+	if tempDir == "" {
+		tempDir = src.TempDir
+	}
+
+	runs := make([]*Stream, 0)
+	chunk := make([][]byte, 0)
+	size := int64(0)
+
+	spill := func() error {
+		sort.SliceStable(chunk, func(i, j int) bool { return less(chunk[i], chunk[j]) })
+		run, err := src.derive("file", tempDir)
+		if err != nil {
+			return errors.Wrap(err, "Error creating sorted run")
+		}
+		runs = append(runs, run)
+		for _, b := range chunk {
+			err := run.Append(b)
+			if err != nil {
+				return errors.Wrap(err, "Error writing sorted run")
+			}
+		}
+		chunk = make([][]byte, 0)
+		size = 0
+		return run.Close()
+	}
+
+	it, err := src.open()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating iterator for source stream")
+	}
+	if it != nil {
+		defer it.Close()
+		for {
+			b, err := it.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				removeAll(runs)
+				return nil, errors.Wrap(err, "Error reading from source stream")
+			}
+			chunk = append(chunk, b)
+			size += int64(len(b) + 8)
+			if size >= budget {
+				err := spill()
+				if err != nil {
+					removeAll(runs)
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(runs) == 0 {
+		sort.SliceStable(chunk, func(i, j int) bool { return less(chunk[i], chunk[j]) })
+		for _, b := range chunk {
+			err := out.Append(b)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error writing to output stream")
+			}
+		}
+		return runs, nil
+	}
+
+	if len(chunk) > 0 {
+		err := spill()
+		if err != nil {
+			removeAll(runs)
+			return nil, err
+		}
+	}
+
+	return runs, nil
+}
+
+// mergeInto merges the sorted streams into out.
+func mergeInto(out *Stream, less func(a, b []byte) bool, streams []*Stream) error {
+	it, err := Merge(less, streams...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		err = out.Append(b)
+		if err != nil {
+			return errors.Wrap(err, "Error writing to output stream")
+		}
+	}
+}
+
+// removeAll removes the blocks of every stream.
+func removeAll(streams []*Stream) {
+	for _, s := range streams {
+		s.Remove()
+	}
+}
+
+// closeAll closes every iterator.
+func closeAll(iterators []Iterator) {
+	for _, it := range iterators {
+		it.Close()
+	}
+}
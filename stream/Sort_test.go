@@ -0,0 +1,160 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// lessBytes orders objects by their bytes.
+func lessBytes(a, b []byte) bool {
+	return bytes.Compare(a, b) < 0
+}
+
+func TestSort(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 50)
+	random := rand.New(rand.NewSource(1))
+	expected := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		object := fmt.Sprintf("k%06d", random.Intn(100000))
+		expected = append(expected, object)
+		err := s.Append([]byte(object))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	sort.Strings(expected)
+	for _, budget := range []int64{0, 500} {
+		out, err := Sort(s, lessBytes, SortOptions{MemoryBudget: budget})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(readStream(t, out)) != fmt.Sprint(expected) {
+			t.Fatalf("objects are not sorted with memory budget %d", budget)
+		}
+	}
+}
+
+func TestSortBlockType(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	for i := 99; i >= 0; i-- {
+		appendRecords(t, s, i, i+1)
+	}
+	s.Close()
+	tempDir := t.TempDir()
+	out, err := Sort(s, lessBytes, SortOptions{MemoryBudget: 200, TempDir: tempDir, BlockType: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, readStream(t, out), 0, 100)
+	for _, block := range out.Blocks {
+		tfb, ok := block.(*TempFileBlock)
+		if !ok {
+			t.Fatalf("expected file blocks but found %T", block)
+		}
+		if !strings.HasPrefix(tfb.TempFile, filepath.Clean(tempDir)) {
+			t.Fatalf("expected file block in %s but found %s", tempDir, tfb.TempFile)
+		}
+	}
+	out.Remove()
+}
+
+func TestSortStable(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	for i := 0; i < 100; i++ {
+		err := s.Append([]byte(fmt.Sprintf("%d,%03d", i%3, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	// Objects are ordered by the key before the comma, so equal keys must keep their order.
+	lessKey := func(a, b []byte) bool {
+		return a[0] < b[0]
+	}
+	for _, budget := range []int64{0, 100} {
+		out, err := Sort(s, lessKey, SortOptions{MemoryBudget: budget, TempDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects := readStream(t, out)
+		if !sort.StringsAreSorted(objects) {
+			t.Fatalf("objects are not in a stable order with memory budget %d: %v", budget, objects)
+		}
+	}
+}
+
+func TestSortRemovesRuns(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	for i := 99; i >= 0; i-- {
+		appendRecords(t, s, i, i+1)
+	}
+	s.Close()
+	tempDir := t.TempDir()
+	out, err := Sort(s, lessBytes, SortOptions{MemoryBudget: 100, TempDir: tempDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, readStream(t, out), 0, 100)
+	if n := countFiles(t, tempDir); n != 0 {
+		t.Fatalf("expected sorted runs to be removed but found %d files", n)
+	}
+}
+
+func TestSortRemovesOutputOnError(t *testing.T) {
+	s := newTestStream(t, "none", "memory", 10)
+	for i := 99; i >= 0; i-- {
+		appendRecords(t, s, i, i+1)
+	}
+	s.Close()
+	tempDir := t.TempDir()
+	// Each chunk of 20 objects is spilled as a run of 2 file blocks and the empty block sealed by Close,
+	// so the 5 runs are 15 files.
+	// Once the sorted stream has sealed its first file block, the files of the runs are removed,
+	// so the merge fails when it reads the second block of a run.
+	runs := []string{}
+	less := func(a, b []byte) bool {
+		files, _ := filepath.Glob(filepath.Join(tempDir, "*"))
+		if len(runs) == 0 && len(files) == 15 {
+			runs = files
+		}
+		if len(runs) > 0 && len(files) > len(runs) {
+			for _, run := range runs {
+				os.Remove(run)
+			}
+		}
+		return lessBytes(a, b)
+	}
+	_, err := Sort(s, less, SortOptions{MemoryBudget: 260, TempDir: tempDir, BlockType: "file"})
+	if err == nil {
+		t.Fatal("expected an error merging the runs")
+	}
+	if n := countFiles(t, tempDir); n != 0 {
+		t.Fatalf("expected the sorted stream to be removed but found %d files", n)
+	}
+}
+
+func TestSortEmpty(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	s.Close()
+	out, err := Sort(s, lessBytes, SortOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(readStream(t, out)); n != 0 {
+		t.Fatalf("expected no objects but found %d", n)
+	}
+}
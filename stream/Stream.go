@@ -10,12 +10,15 @@ package stream
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding"
 	"encoding/binary"
 	"fmt"
 	"compress/gzip"
 	"io"
 	"io/ioutil"
+	"sync"
+	"time"
 )
 
 import (
@@ -43,6 +46,47 @@ type Stream struct {
 	Buffer    *bytes.Buffer  `xml:"-" json:"-"`
 	Writer    Writer `xml:"-" json:"-"`
 	WriteCloser    WriteCloser `xml:"-" json:"-"`
+	Deduplicator *Deduplicator `xml:"-" json:"-"` // if not nil, duplicate objects are dropped by WriteRecord
+	KeyFunc func(b []byte) []byte `xml:"-" json:"-"` // if not nil, returns the key of an object used to collect block statistics
+	BloomFilterRate float64 `xml:"-" json:"-"` // if positive and KeyFunc is not nil, a bloom filter of keys with this false positive rate is built for every block
+	Sorted bool `xml:"-" json:"-"` // if true, WriteRecord rejects objects whose key is less than the key of the previous object
+	Compare func(a []byte, b []byte) int `xml:"-" json:"-"` // compares keys of a sorted stream.  Defaults to bytes.Compare.
+	Indexes map[string]*Index `xml:"-" json:"-"` // secondary indexes by name, added with AddIndex
+	Extractor FieldExtractor `xml:"-" json:"-"` // splits records into columns for the columnar block type
+	Transform string `xml:"-" json:"-"` // the transform applied to records before compression: prefix, dictionary, or empty for none
+	Store BlockStore `xml:"-" json:"-"` // if not nil, blocks are kept in this content-addressed store instead of by BlockType
+	MaxRecords int `xml:"-" json:"-"` // if positive, the oldest blocks are evicted while the stream holds more records
+	MaxBytes int64 `xml:"-" json:"-"` // if positive, the oldest blocks are evicted while the blocks hold more compressed bytes
+	MaxAge time.Duration `xml:"-" json:"-"` // if positive, blocks created longer ago are evicted
+	Timestamp func(b []byte) time.Time `xml:"-" json:"-"` // if not nil, returns the time of an object used by WindowSize and Window
+	WindowSize time.Duration `xml:"-" json:"-"` // if positive and Timestamp is not nil, the buffer is rotated so every block holds one tumbling window of this size
+	WAL *WAL `xml:"-" json:"-"` // if not nil, objects are appended to this write-ahead log before they are buffered
+	nextBlockID int
+	bufferID int // the identifier reserved for the block the buffer is sealed into
+	bufferReserved bool // true if bufferID is reserved
+	mutex sync.Mutex
+	closed bool
+	changed chan struct{}
+	subscribers []*Subscriber
+	publishSeq uint64 // the sequence number of the next record published to the subscribers
+	published uint64 // the number of records published to the subscribers, guarded by publishMutex
+	publishMutex sync.Mutex
+	publishCond *sync.Cond
+	count int // the number of records written to the buffer
+	written int // the number of bytes written to the buffer, including with Write
+	stats *BlockStats // the statistics of the records written to the buffer
+	hashes [][2]uint64 // the bloom filter hashes of the keys of the records written to the buffer
+	lastKey []byte // the key of the last record written to a sorted stream
+	transform *recordTransform // encodes the records written to the buffer, if Transform is set
+	windowStart time.Time // the start of the window of the records written to the buffer
+	refs map[Block]int // the number of open iterators using each block
+	retired map[Block]bool // blocks removed from the stream that are removed once no iterator uses them
+	moved map[int]Cursor // the position in its replacement of the first object of each block rewritten by Compact
+	movedFrom map[int][]int // the identifiers of the blocks whose objects were moved into each block by Compact
+	rewrites int // the number of times Blocks were replaced by swap or Remove, so Compact and Transcode detect a concurrent rewrite
+	totals map[Block]blockTotal // the number of objects and bytes of each block, once retention is enforced
+	records int // the number of objects in Blocks, once retention is enforced
+	bytes int64 // the number of compressed bytes in Blocks, once retention is enforced
 }
 
 func New(alg string, endianness string, blockSize int, block_type string, tempDir string) (*Stream, error) {
@@ -64,6 +108,30 @@ func New(alg string, endianness string, blockSize int, block_type string, tempDi
 	return s, nil
 }
 
+// Endianness returns the byte order of the stream as a string: big or little.
+func (s *Stream) Endianness() string {
+	if s.BigEndian {
+		return "big"
+	}
+	return "little"
+}
+
+// derive returns a new initialized stream with the same algorithm, endianness, block size, extractor, and transform as this stream.
+// Streams whose objects are not objects of this stream must not use the columnar block type, see rowBlockType.
+func (s *Stream) derive(blockType string, tempDir string) (*Stream, error) {
+	d, err := New(s.Algorithm, s.Endianness(), s.BlockSize, blockType, tempDir)
+	if err != nil {
+		return d, err
+	}
+	d.Extractor = s.Extractor
+	d.Transform = s.Transform
+	err = d.Init()
+	if err != nil {
+		return d, errors.Wrap(err, "Error initializing stream")
+	}
+	return d, nil
+}
+
 func (s *Stream) Size() (int64, error) {
 	if s.Buffer != nil {
 		return int64(s.Buffer.Len()), nil
@@ -80,6 +148,28 @@ func (s *Stream) Size() (int64, error) {
 }
 
 func (s *Stream) Init() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.init()
+}
+
+// init creates the buffer, writer, and record transform.  The caller must hold the stream's mutex.
+func (s *Stream) init() error {
+	s.closed = false
+	s.count = 0
+	s.written = 0
+	s.stats = nil
+	s.hashes = nil
+	if !s.bufferReserved {
+		s.bufferID = s.nextBlockID
+		s.nextBlockID += 1
+		s.bufferReserved = true
+	}
+	transform, err := newRecordTransform(s.Transform)
+	if err != nil {
+		return err
+	}
+	s.transform = transform
 	switch s.Algorithm {
 	case "snappy":
 		s.Buffer = new(bytes.Buffer)
@@ -100,7 +190,11 @@ func (s *Stream) Init() error {
 }
 
 func (s *Stream) Write(b []byte) (n int, err error) {
-	return s.Writer.Write(b)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n, err = s.Writer.Write(b)
+	s.written += n
+	return n, err
 }
 
 func (s *Stream) WriteObject(obj encoding.BinaryMarshaler) (n int, err error) {
@@ -108,31 +202,229 @@ func (s *Stream) WriteObject(obj encoding.BinaryMarshaler) (n int, err error) {
 	if err != nil {
 		return 0, errors.Wrap(err, "Error marshalling object to bytes.")
 	}
+	return s.WriteRecord(b)
+}
+
+// WriteRecord writes the bytes of an object to the stream prefixed by its size,
+// and then publishes the bytes to the stream's subscribers.
+// If the stream has a Deduplicator and the object is a duplicate, then the object is dropped and 0 bytes are written.
+// If the stream has a WAL, then the object is appended to the log before it is buffered.
+// If the stream is sorted and the object is out of order, then returns an error wrapping ErrOutOfOrder.
+// If the write fails, then the log, Deduplicator, and sort order of the stream are left as they were, so the object can be retried.
+func (s *Stream) WriteRecord(b []byte) (n int, err error) {
+	s.mutex.Lock()
+	var key []byte
+	if s.Sorted {
+		key = s.key(b)
+		if s.lastKey != nil && s.compare(key, s.lastKey) < 0 {
+			s.mutex.Unlock()
+			return 0, errors.Wrap(ErrOutOfOrder, "Error writing object to sorted stream")
+		}
+	}
+	var dedupKey []byte
+	if s.Deduplicator != nil {
+		dedupKey = s.Deduplicator.Options.KeyFunc(b)
+		if s.Deduplicator.contains(dedupKey) {
+			s.Deduplicator.Dropped += 1
+			s.mutex.Unlock()
+			return 0, nil
+		}
+	}
+	var start time.Time
+	if s.windowed() {
+		start = s.Timestamp(b).Truncate(s.WindowSize)
+		if s.count > 0 && !start.Equal(s.windowStart) {
+			err := s.rotate()
+			if err != nil {
+				s.mutex.Unlock()
+				return 0, errors.Wrap(err, "Error rotating buffer to block for new window")
+			}
+			s.notify()
+		}
+	}
+	offset := int64(0)
+	if s.WAL != nil {
+		offset, err = s.WAL.append(b)
+		if err != nil {
+			s.mutex.Unlock()
+			return 0, errors.Wrap(err, "Error writing object to write-ahead log")
+		}
+	}
+	n, err = s.writeRecord(b)
+	if err != nil {
+		// Remove the object from the log, so a recovery does not replay an object that was never buffered.
+		if s.WAL != nil {
+			rerr := s.WAL.rollback(offset)
+			if rerr != nil {
+				err = errors.Wrap(rerr, "Error rolling back write-ahead log after error \""+err.Error()+"\"")
+			}
+		}
+		s.mutex.Unlock()
+		return n, err
+	}
+	if s.windowed() {
+		s.windowStart = start
+	}
+	if s.Sorted {
+		s.lastKey = append(make([]byte, 0, len(key)), key...)
+	}
+	if s.Deduplicator != nil {
+		s.Deduplicator.insert(dedupKey)
+	}
+	subscribers := s.subscribers
+	if len(subscribers) == 0 {
+		s.mutex.Unlock()
+		return n, nil
+	}
+	seq := s.publishSeq
+	s.publishSeq += 1
+	s.mutex.Unlock()
+	s.publish(seq, subscribers, append(make([]byte, 0, len(b)), b...))
+	return n, nil
+}
+
+// publish publishes the record to the subscribers after every record with a lower sequence number,
+// so subscribers receive records in the order they were written even with concurrent writers.
+func (s *Stream) publish(seq uint64, subscribers []*Subscriber, b []byte) {
+	s.waitPublished(seq)
+	for _, sub := range subscribers {
+		sub.publish(b)
+	}
+	s.publishMutex.Lock()
+	s.published += 1
+	s.publishCond.Broadcast()
+	s.publishMutex.Unlock()
+}
+
+// waitPublished blocks until the first seq records have been published to the subscribers.
+func (s *Stream) waitPublished(seq uint64) {
+	s.publishMutex.Lock()
+	defer s.publishMutex.Unlock()
+	if s.publishCond == nil {
+		s.publishCond = sync.NewCond(&s.publishMutex)
+	}
+	for s.published < seq {
+		s.publishCond.Wait()
+	}
+}
+
+// finishSubscribers marks the subscribers finished once the first seq records have been published to them.
+func (s *Stream) finishSubscribers(subscribers []*Subscriber, seq uint64) {
+	s.waitPublished(seq)
+	for _, sub := range subscribers {
+		sub.finish()
+	}
+}
+
+// writeRecord writes the size and bytes of an object to the writer.  The caller must hold the stream's mutex.
+func (s *Stream) writeRecord(b []byte) (n int, err error) {
+	content := b
+	if s.transform != nil {
+		content = s.transform.encode(b)
+	}
 	h := new(bytes.Buffer)
 	if s.BigEndian {
-		binary.Write(h, binary.BigEndian, uint64(len(b)))
+		binary.Write(h, binary.BigEndian, uint64(len(content)))
 	} else {
-		binary.Write(h, binary.LittleEndian, uint64(len(b)))
+		binary.Write(h, binary.LittleEndian, uint64(len(content)))
 	}
-	n1, err := s.Write(h.Bytes())
+	n1, err := s.Writer.Write(h.Bytes())
+	s.written += n1
 	if err != nil {
 		return n1, errors.Wrap(err, "Error writing object size to stream.")
 	}
-	n2, err := s.Write(b)
+	n2, err := s.Writer.Write(content)
+	s.written += n2
 	if err != nil {
 		return n1+n2, errors.Wrap(err, "Error writing object content to stream.")
 	}
+	if s.transform != nil {
+		s.transform.add(b)
+	}
+	for _, idx := range s.Indexes {
+		idx.add(b, s.count)
+	}
+	s.count += 1
+	if s.KeyFunc != nil {
+		if s.stats == nil {
+			s.stats = &BlockStats{}
+		}
+		key := s.KeyFunc(b)
+		s.stats.Add(key)
+		if s.BloomFilterRate > 0 && key != nil {
+			s.hashes = append(s.hashes, bloomHash(key))
+		}
+	}
 	return n1+n2, nil
 }
 
+// key returns the key of the object using KeyFunc, or the object itself if KeyFunc is nil.
+func (s *Stream) key(b []byte) []byte {
+	if s.KeyFunc != nil {
+		return s.KeyFunc(b)
+	}
+	return b
+}
+
+// compare compares two keys using Compare, or bytes.Compare if Compare is nil.
+func (s *Stream) compare(a []byte, b []byte) int {
+	if s.Compare != nil {
+		return s.Compare(a, b)
+	}
+	return bytes.Compare(a, b)
+}
+
+// Append writes the bytes of an object to the stream with WriteRecord,
+// and then rotates the buffer into a new block once BlockSize objects have been written to it.
+// If the stream is windowed, then the buffer is rotated only when an object starts a new window.
+func (s *Stream) Append(b []byte) error {
+	_, err := s.WriteRecord(b)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.windowed() && s.BlockSize > 0 && s.count >= s.BlockSize {
+		err := s.rotate()
+		if err != nil {
+			return errors.Wrap(err, "Error rotating buffer to block")
+		}
+		s.notify()
+	}
+	return nil
+}
+
+// Flush flushes the buffer's writer so followers can read the objects written so far, and syncs the write-ahead log, if any.
 func (s *Stream) Flush() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.WAL != nil {
+		err := s.WAL.Sync()
+		if err != nil {
+			return err
+		}
+	}
 	if s.Writer != nil {
-		return s.Writer.Flush()
+		err := s.Writer.Flush()
+		s.notify()
+		return err
 	}
 	return nil
 }
 
 func (s *Stream) Rotate() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.rotate()
+	if err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// rotate seals the buffer into a new block and creates a new buffer.  The caller must hold the stream's mutex.
+func (s *Stream) rotate() error {
 
 	if s.Buffer == nil {
 		return errors.New("Error rotating buffer to block.  Buffer is nil.")
@@ -156,13 +448,18 @@ func (s *Stream) Rotate() error {
 	if err != nil {
 		return errors.Wrap(err, "Error reading buffer into bytes.")
 	}
-	err = s.AppendBlock(b)
+	err = s.appendBuffer(b)
 	if err != nil {
 		return errors.Wrap(err, "Error appending new block")
 	}
 	//s.Blocks = append(s.Blocks, NewMemoryBlock(s.Algorithm, s.BigEndian, b))
 
-	err = s.Init()
+	_, err = s.evict()
+	if err != nil {
+		return errors.Wrap(err, "Error evicting blocks")
+	}
+
+	err = s.init()
 	if err != nil {
 		return err
 	}
@@ -171,6 +468,8 @@ func (s *Stream) Rotate() error {
 }
 
 func (s *Stream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
 	if s.Writer != nil {
 		err := s.Writer.Flush()
@@ -191,19 +490,98 @@ func (s *Stream) Close() error {
 		if err != nil {
 			return errors.Wrap(err, "Error reading buffer into bytes.")
 		}
-		err = s.AppendBlock(b)
+		err = s.appendBuffer(b)
 		if err != nil {
 			return errors.Wrap(err, "Error appending new block")
 		}
 		//s.Blocks = append(s.Blocks, NewMemoryBlock(s.Algorithm, s.BigEndian, b))
 		s.Buffer = nil
+		_, err = s.evict()
+		if err != nil {
+			return errors.Wrap(err, "Error evicting blocks")
+		}
 	}
 
+	s.closed = true
+	s.notify()
+
+	// Records written before Close may still be publishing outside the mutex.
+	go s.finishSubscribers(s.subscribers, s.publishSeq)
+
 	return nil
 }
 
+// Iterator returns a new iterator over a snapshot of the stream's blocks.
+// Blocks removed from the stream by Compact are not removed from storage until the iterator is closed.
 func (s *Stream) Iterator() (*StreamIterator, error) {
-	return NewStreamIterator(s.Blocks)
+	it, err := s.open()
+	if err != nil {
+		return &StreamIterator{}, err
+	}
+	if it == nil {
+		return NewStreamIterator(nil)
+	}
+	return it, nil
+}
+
+// open returns a new iterator over a snapshot of the stream's blocks, or nil if the stream has no blocks.
+func (s *Stream) open() (*StreamIterator, error) {
+	s.mutex.Lock()
+	blocks := s.Blocks
+	if len(blocks) == 0 {
+		s.mutex.Unlock()
+		return nil, nil
+	}
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	it, err := NewStreamIterator(blocks)
+	if err != nil {
+		s.release(blocks)
+		return nil, err
+	}
+	it.release = func() { s.release(blocks) }
+	return it, nil
+}
+
+// Follow returns a new iterator that follows the stream as it is written.
+// The iterator finishes when the stream is closed or the context is cancelled.
+func (s *Stream) Follow(ctx context.Context) *FollowIterator {
+	return NewFollowIterator(ctx, s)
+}
+
+// IteratorFrom returns a new iterator for the stream that resumes at the given cursor.
+// If the cursor's block was rewritten by Compact, then the iterator resumes at the same object in the block that replaced it.
+// If the cursor's block no longer exists in the stream, then returns an error wrapping ErrBlockNotFound.
+func (s *Stream) IteratorFrom(c Cursor) (*StreamIterator, error) {
+	s.mutex.Lock()
+	blocks := s.Blocks
+	i, offset, ok := s.resolve(c)
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	if !ok {
+		s.release(blocks)
+		return &StreamIterator{}, errors.Wrap(ErrBlockNotFound, "Error resuming from cursor "+c.String()+".  Block "+fmt.Sprint(c.BlockID)+" no longer exists in stream")
+	}
+	block := blocks[i]
+	bi, err := block.Iterator()
+	if err != nil {
+		s.release(blocks)
+		return &StreamIterator{}, errors.Wrap(err, "Error creating iterator for block "+fmt.Sprint(block.GetID()))
+	}
+	err = bi.Skip(offset)
+	if err != nil {
+		bi.Close()
+		s.release(blocks)
+		return &StreamIterator{}, errors.Wrap(err, "Error skipping to offset "+fmt.Sprint(offset)+" in block "+fmt.Sprint(block.GetID()))
+	}
+	si := &StreamIterator{
+		Blocks: blocks,
+		BlockIndex: i,
+		Position: offset,
+		BlockIterator: bi,
+		release: func() { s.release(blocks) },
+	}
+	return si, nil
 }
 
 func (s *Stream) Reader(n int) (*Reader, error) {
@@ -215,8 +593,34 @@ func (s *Stream) BlockIterator(n int) (*BlockIterator, error) {
 	return s.Blocks[n].Iterator()
 }
 
+// Get returns the bytes for the object at the given position in the stream, and an error if any.
+// If the number of objects in every block is known, then the block is found using the counts,
+// else every block is assumed to have BlockSize objects.
 func (s *Stream) Get(position int) ([]byte, error) {
 
+	s.mutex.Lock()
+	blocks := s.Blocks
+	s.mutex.Unlock()
+
+	offset := 0
+	for i, block := range blocks {
+		count := block.GetCount()
+		if count < 0 {
+			break
+		}
+		if position < offset+count {
+			b, err := block.Get(position - offset)
+			if err != nil {
+				return make([]byte, 0), errors.Wrap(err, "Error reading from block "+fmt.Sprint(i)+" at position "+fmt.Sprint(position-offset))
+			}
+			return b, nil
+		}
+		offset += count
+		if i == len(blocks)-1 {
+			return make([]byte, 0), errors.New("Error reading position "+fmt.Sprint(position)+".  Greater than number of objects "+fmt.Sprint(offset))
+		}
+	}
+
 	blockIndex := int(position / s.BlockSize)
 	if blockIndex >= len(s.Blocks) {
 		return make([]byte, 0), errors.New("Error reading from block "+fmt.Sprint(blockIndex)+".  Greater than number of blocks "+fmt.Sprint(len(s.Blocks)))
@@ -229,25 +633,171 @@ func (s *Stream) Get(position int) ([]byte, error) {
 	return b, nil
 }
 
+// AppendBlock appends a new block initialized with "b", the compressed bytes of a block.
+// If the stream has a Store, then the bytes are stored once for every unique digest.
 func (s *Stream) AppendBlock(b []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := s.nextBlockID
+	s.nextBlockID += 1
+	err := s.appendBlock(b, -1, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.evict()
+	if err != nil {
+		return errors.Wrap(err, "Error evicting blocks")
+	}
+	s.notify()
+	return nil
+}
+
+// rowBlockType returns the block type, or memory if the block type is columnar,
+// for derived streams whose objects cannot be split into columns by the Extractor.
+func rowBlockType(blockType string) string {
+	if blockType == "columnar" {
+		return "memory"
+	}
+	return blockType
+}
+
+// newBlock returns a new uninitialized block of the given type: memory, file, or columnar.
+// The extractor is only used by columnar blocks.
+func newBlock(blockType string, algorithm string, bigEndian bool, tempDir string, extractor FieldExtractor) Block {
+	switch blockType {
+	case "file":
+		return NewTempFileBlock(algorithm, bigEndian, tempDir)
+	case "columnar":
+		return NewColumnarBlock(algorithm, bigEndian, extractor)
+	}
+	return NewMemoryBlock(algorithm, bigEndian)
+}
+
+// appendBuffer appends a new block initialized with "b", the sealed contents of the buffer,
+// with the count and statistics of the records written to the buffer.  The caller must hold the stream's mutex.
+func (s *Stream) appendBuffer(b []byte) error {
+	err := s.appendBlock(b, s.count, s.bufferID)
+	if err != nil {
+		return err
+	}
+	s.bufferReserved = false
+	block := s.Blocks[len(s.Blocks)-1]
+	block.SetStats(s.stats)
+	if s.windowed() && s.count > 0 {
+		block.SetWindow(s.windowStart, s.windowStart.Add(s.WindowSize))
+	}
+	if s.KeyFunc != nil && s.BloomFilterRate > 0 {
+		filter := NewBloomFilter(len(s.hashes), s.BloomFilterRate)
+		for _, hash := range s.hashes {
+			filter.addHash(hash)
+		}
+		block.SetFilter(filter)
+	}
+	for name, idx := range s.Indexes {
+		err := idx.seal(block.GetID())
+		if err != nil {
+			return errors.Wrap(err, "Error updating index \""+name+"\"")
+		}
+	}
+	if s.WAL != nil {
+		err := s.WAL.Truncate()
+		if err != nil {
+			return errors.Wrap(err, "Error truncating write-ahead log")
+		}
+	}
+	return nil
+}
+
+// appendBlock appends a new block with the identifier "id" initialized with "b" holding "count" objects.
+// If the count is unknown, then count is -1.  The caller must hold the stream's mutex.
+func (s *Stream) appendBlock(b []byte, count int, id int) error {
 	var block Block
-	if s.BlockType == "file" {
-		block = NewTempFileBlock(s.Algorithm, s.BigEndian, s.TempDir)
+	if s.Store != nil {
+		block = NewContentBlock(s.Algorithm, s.BigEndian, s.Store)
 	} else {
-		block = NewMemoryBlock(s.Algorithm, s.BigEndian)
+		block = newBlock(s.BlockType, s.Algorithm, s.BigEndian, s.TempDir, s.Extractor)
 	}
+	block.SetTransform(s.Transform)
 	err := block.Init(b)
 	if err != nil {
 		return errors.Wrap(err, "Error initializing block.")
 	}
+	block.SetCount(count)
+	block.SetCreated(time.Now())
+	block.SetID(id)
 	s.Blocks = append(s.Blocks, block)
+	s.track([]Block{block})
 	return nil
 }
 
 func (s *Stream) Remove() error {
-	for _, b := range s.Blocks {
-		b.Remove()
-	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.untrack(s.Blocks)
+	s.retire(s.Blocks)
 	s.Blocks = make([]Block, 0)
+	s.rewrites += 1
+	s.moved = nil
+	s.movedFrom = nil
+	for _, idx := range s.Indexes {
+		idx.Stream.Remove()
+	}
 	return nil
 }
+
+// acquire marks the blocks as used by an iterator.  The caller must hold the stream's mutex.
+func (s *Stream) acquire(blocks []Block) {
+	if s.refs == nil {
+		s.refs = map[Block]int{}
+	}
+	for _, block := range blocks {
+		s.refs[block] += 1
+	}
+}
+
+// release marks the blocks as no longer used by an iterator, and removes retired blocks that are no longer used.
+func (s *Stream) release(blocks []Block) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, block := range blocks {
+		s.refs[block] -= 1
+		if s.refs[block] > 0 {
+			continue
+		}
+		delete(s.refs, block)
+		if s.retired[block] {
+			delete(s.retired, block)
+			block.Remove()
+		}
+	}
+}
+
+// retire removes the blocks from storage, or once no iterator uses them.  The caller must hold the stream's mutex.
+func (s *Stream) retire(blocks []Block) {
+	for _, block := range blocks {
+		if s.refs[block] > 0 {
+			if s.retired == nil {
+				s.retired = map[Block]bool{}
+			}
+			s.retired[block] = true
+			continue
+		}
+		block.Remove()
+	}
+}
+
+// changes returns a channel that is closed the next time the stream changes.  The caller must hold the stream's mutex.
+func (s *Stream) changes() <-chan struct{} {
+	if s.changed == nil {
+		s.changed = make(chan struct{})
+	}
+	return s.changed
+}
+
+// notify wakes all goroutines waiting for the stream to change.  The caller must hold the stream's mutex.
+func (s *Stream) notify() {
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
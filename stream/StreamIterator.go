@@ -18,7 +18,9 @@ import (
 type StreamIterator struct {
   Blocks []Block `xml:"-" json:"-"`
   BlockIndex int `xml:"-" json:"-"`
+  Position int `xml:"-" json:"-"` // the number of records read from the current block
   BlockIterator *BlockIterator `xml:"-" json:"-"`
+  release func() // releases the snapshot of blocks held by the iterator
 }
 
 func NewStreamIterator(blocks []Block) (*StreamIterator, error) {
@@ -34,6 +36,7 @@ func NewStreamIterator(blocks []Block) (*StreamIterator, error) {
   si := &StreamIterator{
     Blocks: blocks,
     BlockIndex: 0,
+    Position: 0,
     BlockIterator: bi,
   }
 
@@ -45,15 +48,47 @@ func (si *StreamIterator) Next() ([]byte, error) {
   if err != nil {
     if err == io.EOF {
       if si.BlockIndex < len(si.Blocks) - 1 {
+        err = si.BlockIterator.Close()
+        if err != nil {
+          return make([]byte, 0), errors.Wrap(err, "Error closing block iterator")
+        }
         si.BlockIndex += 1
         bi, err := si.Blocks[si.BlockIndex].Iterator()
         if err != nil {
           return make([]byte, 0), errors.Wrap(err, "Error creating stream iterator")
         }
         si.BlockIterator = bi
+        si.Position = 0
         return si.Next()
       }
     }
+    return b, err
+  }
+  si.Position += 1
+  return b, nil
+}
+
+// Cursor returns the current position of the iterator.
+// Pass the cursor to Stream.IteratorFrom to resume iteration at the same record.
+// If the iterator has no current block, then returns EndCursor.
+func (si *StreamIterator) Cursor() Cursor {
+  if si.BlockIndex < 0 || si.BlockIndex >= len(si.Blocks) {
+    return EndCursor
+  }
+  return Cursor{
+    BlockID: si.Blocks[si.BlockIndex].GetID(),
+    Offset: si.Position,
+  }
+}
+
+// Close closes the iterator's current BlockIterator and releases the iterator's snapshot of blocks.
+func (si *StreamIterator) Close() error {
+  if si.release != nil {
+    defer si.release()
+    si.release = nil
+  }
+  if si.BlockIterator == nil || si.BlockIterator.Reader == nil {
+    return nil
   }
-  return b, err
+  return si.BlockIterator.Close()
 }
@@ -0,0 +1,126 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStream returns a new initialized stream that writes temp files to a directory removed after the test.
+func newTestStream(t *testing.T, algorithm string, blockType string, blockSize int) *Stream {
+	t.Helper()
+	s, err := New(algorithm, "little", blockSize, blockType, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testRecord returns the record written at position i by appendRecords.
+func testRecord(i int) string {
+	return fmt.Sprintf("r%04d", i)
+}
+
+// appendRecords appends the records from position start up to but excluding end with Append.
+func appendRecords(t *testing.T, s *Stream, start int, end int) {
+	t.Helper()
+	for i := start; i < end; i++ {
+		err := s.Append([]byte(testRecord(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readAll returns every object of the iterator as a string and closes the iterator.
+func readAll(t *testing.T, it Iterator) []string {
+	t.Helper()
+	defer it.Close()
+	objects := make([]string, 0)
+	for {
+		b, err := it.Next()
+		if err != nil {
+			if err == io.EOF {
+				return objects
+			}
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+	}
+}
+
+// readStream returns every object in the stream as a string.
+func readStream(t *testing.T, s *Stream) []string {
+	t.Helper()
+	it, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readAll(t, it)
+}
+
+// expectRecords fails the test unless the objects are the records from position start up to but excluding end.
+func expectRecords(t *testing.T, objects []string, start int, end int) {
+	t.Helper()
+	if len(objects) != end-start {
+		t.Fatalf("expected %d objects but found %d: %v", end-start, len(objects), objects)
+	}
+	for i, object := range objects {
+		if object != testRecord(start+i) {
+			t.Fatalf("expected %q at position %d but found %q", testRecord(start+i), i, object)
+		}
+	}
+}
+
+// countFiles returns the number of regular files in the directory and its subdirectories.
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			n += 1
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestStreamAppend(t *testing.T) {
+	for _, algorithm := range []string{"snappy", "gzip", "none"} {
+		for _, blockType := range []string{"memory", "file"} {
+			s := newTestStream(t, algorithm, blockType, 10)
+			appendRecords(t, s, 0, 25)
+			err := s.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.Blocks) != 3 {
+				t.Fatalf("expected 3 blocks but found %d", len(s.Blocks))
+			}
+			expectRecords(t, readStream(t, s), 0, 25)
+			b, err := s.Get(17)
+			if err != nil || string(b) != testRecord(17) {
+				t.Fatal(string(b), err)
+			}
+		}
+	}
+}
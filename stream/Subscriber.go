@@ -0,0 +1,362 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DefaultSubscriberCapacity is the capacity of a subscriber's queue if SubscribeOptions.Capacity is zero.
+const DefaultSubscriberCapacity = 1024
+
+const (
+	PolicyBlock = "block" // the producer waits for the subscriber to catch up
+	PolicyDrop  = "drop"  // records are dropped while the subscriber is behind
+	PolicySpill = "spill" // records are spilled to temp file blocks while the subscriber is behind
+)
+
+// SubscribeOptions are the options for a subscriber.
+type SubscribeOptions struct {
+	Policy   string        // the slow-consumer policy: block, drop, or spill.  Defaults to block.
+	Capacity int           // the number of records queued in memory before the policy applies.  Defaults to DefaultSubscriberCapacity.
+	Timeout  time.Duration // the maximum time the producer waits with the block policy before dropping the record.  Zero waits indefinitely.
+	TempDir  string        // the directory for temp file blocks with the spill policy.  Defaults to the stream's TempDir.
+}
+
+// SubscriberStats are the metrics for a subscriber.
+type SubscriberStats struct {
+	Delivered int64 `xml:"delivered" json:"delivered"` // the number of records returned by Next
+	Dropped   int64 `xml:"dropped" json:"dropped"`     // the number of records dropped by the policy
+	Spilled   int64 `xml:"spilled" json:"spilled"`     // the number of records spilled to temp file blocks
+	Lag       int   `xml:"lag" json:"lag"`             // the number of records published but not yet delivered
+}
+
+// Subscriber is an iterator that receives every record written to a stream after it subscribed.
+// Each subscriber has its own queue, so a slow subscriber does not slow the others.
+type Subscriber struct {
+	Stream  *Stream          `xml:"-" json:"-"`
+	Options SubscribeOptions `xml:"-" json:"-"`
+	records chan []byte
+	signal  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	// the following fields are guarded by the mutex
+	mutex         sync.Mutex
+	finished      bool
+	closed        bool
+	spill         *Stream
+	spilling      bool
+	spilled       int      // the number of spilled records not yet delivered
+	pending       [][]byte // the spilled records not yet written to a block of the spill stream
+	spillBlock    Block    // the block of the spill stream being read
+	spillIterator *BlockIterator
+	// the following fields are updated atomically
+	delivered    int64
+	dropped      int64
+	spilledTotal int64
+}
+
+// Subscribe returns a new subscriber that receives every record written to the stream with WriteRecord or WriteObject.
+// Next returns io.EOF once the stream is closed and every queued record has been delivered.
+func (s *Stream) Subscribe(options SubscribeOptions) (*Subscriber, error) {
+
+	if options.Policy == "" {
+		options.Policy = PolicyBlock
+	}
+	if options.Capacity < 0 {
+		return nil, errors.New("Invalid capacity " + fmt.Sprint(options.Capacity) + ".  Capacity cannot be negative.")
+	}
+	if options.Capacity == 0 {
+		options.Capacity = DefaultSubscriberCapacity
+	}
+
+	sub := &Subscriber{
+		Stream:  s,
+		Options: options,
+		records: make(chan []byte, options.Capacity),
+		signal:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	switch options.Policy {
+	case PolicyBlock, PolicyDrop:
+	case PolicySpill:
+		tempDir := options.TempDir
+		if tempDir == "" {
+			tempDir = s.TempDir
+		}
+		// Spilled records are written to a block once a block's worth is pending.
+		blockSize := s.BlockSize
+		if blockSize <= 0 {
+			blockSize = options.Capacity
+		}
+		spill, err := New(s.Algorithm, s.Endianness(), blockSize, "file", tempDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating spill stream for subscriber")
+		}
+		err = spill.Init()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error initializing spill stream for subscriber")
+		}
+		sub.spill = spill
+	default:
+		return nil, errors.New("Unknown subscriber policy \"" + options.Policy + "\"")
+	}
+
+	s.mutex.Lock()
+	s.subscribers = append(s.subscribers, sub)
+	if s.closed {
+		sub.finish()
+	}
+	s.mutex.Unlock()
+
+	return sub, nil
+}
+
+// publish queues the record for the subscriber according to the subscriber's policy.
+func (sub *Subscriber) publish(b []byte) {
+	switch sub.Options.Policy {
+	case PolicyBlock:
+		if sub.Options.Timeout == 0 {
+			select {
+			case sub.records <- b:
+			case <-sub.done:
+			}
+			return
+		}
+		timer := time.NewTimer(sub.Options.Timeout)
+		defer timer.Stop()
+		select {
+		case sub.records <- b:
+		case <-sub.done:
+		case <-timer.C:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	case PolicyDrop:
+		select {
+		case sub.records <- b:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	case PolicySpill:
+		sub.mutex.Lock()
+		defer sub.mutex.Unlock()
+		if sub.closed {
+			return
+		}
+		if !sub.spilling {
+			select {
+			case sub.records <- b:
+				return
+			default:
+				// Once spilling, every record goes to the spill stream until it is drained to preserve order.
+				sub.spilling = true
+			}
+		}
+		sub.pending = append(sub.pending, b)
+		sub.spilled += 1
+		atomic.AddInt64(&sub.spilledTotal, 1)
+		if len(sub.pending) >= sub.spill.BlockSize {
+			err := sub.writePending()
+			if err != nil {
+				atomic.AddInt64(&sub.dropped, int64(len(sub.pending)))
+				sub.spilled -= len(sub.pending)
+				sub.pending = nil
+			}
+		}
+		sub.wake()
+	}
+}
+
+// writePending writes the pending spilled records to a new block of the spill stream.  The caller must hold the mutex.
+func (sub *Subscriber) writePending() error {
+	for _, b := range sub.pending {
+		_, err := sub.spill.WriteRecord(b)
+		if err != nil {
+			return errors.Wrap(err, "Error writing to spill stream")
+		}
+	}
+	err := sub.spill.Rotate()
+	if err != nil {
+		return errors.Wrap(err, "Error rotating spill stream")
+	}
+	sub.pending = nil
+	return nil
+}
+
+// finish marks that no more records will be published.
+func (sub *Subscriber) finish() {
+	sub.mutex.Lock()
+	sub.finished = true
+	sub.mutex.Unlock()
+	sub.wake()
+}
+
+// wake signals a waiting Next without blocking.
+func (sub *Subscriber) wake() {
+	select {
+	case sub.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the bytes of the next record published to the subscriber, blocking until one is available.
+func (sub *Subscriber) Next() ([]byte, error) {
+	for {
+
+		select {
+		case b := <-sub.records:
+			atomic.AddInt64(&sub.delivered, 1)
+			return b, nil
+		case <-sub.done:
+			return make([]byte, 0), io.EOF
+		default:
+		}
+
+		if sub.spill != nil {
+			b, ok, err := sub.nextSpilled()
+			if err != nil {
+				return b, err
+			}
+			if ok {
+				atomic.AddInt64(&sub.delivered, 1)
+				return b, nil
+			}
+		}
+
+		sub.mutex.Lock()
+		finished := sub.finished
+		spilled := sub.spilled
+		sub.mutex.Unlock()
+		if finished && spilled == 0 && len(sub.records) == 0 {
+			return make([]byte, 0), io.EOF
+		}
+
+		select {
+		case b := <-sub.records:
+			atomic.AddInt64(&sub.delivered, 1)
+			return b, nil
+		case <-sub.signal:
+		case <-sub.done:
+			return make([]byte, 0), io.EOF
+		}
+	}
+}
+
+// nextSpilled returns the next spilled record, and true if a record was found.
+// The blocks of the spill stream are read first, since they hold older records than the pending records.
+// The mutex is held while reading so Close cannot close the spill iterator during a read.
+func (sub *Subscriber) nextSpilled() ([]byte, bool, error) {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	for {
+		if sub.closed {
+			return nil, false, nil
+		}
+		if sub.spillIterator == nil {
+			if len(sub.spill.Blocks) == 0 {
+				if len(sub.pending) == 0 {
+					sub.spilling = false
+					return nil, false, nil
+				}
+				b := sub.pending[0]
+				sub.pending = sub.pending[1:]
+				sub.spilled -= 1
+				return b, true, nil
+			}
+			block := sub.spill.Blocks[0]
+			sub.spill.Blocks = sub.spill.Blocks[1:]
+			it, err := block.Iterator()
+			if err != nil {
+				block.Remove()
+				return make([]byte, 0), false, errors.Wrap(err, "Error creating iterator for spill block")
+			}
+			sub.spillBlock = block
+			sub.spillIterator = it
+		}
+
+		b, err := sub.spillIterator.Next()
+		if err == nil {
+			sub.spilled -= 1
+			return b, true, nil
+		}
+		if err != io.EOF {
+			return b, false, errors.Wrap(err, "Error reading from spill stream")
+		}
+
+		sub.spillIterator.Close()
+		sub.spillBlock.Remove()
+		sub.spillBlock = nil
+		sub.spillIterator = nil
+	}
+}
+
+// Lag returns the number of records published to the subscriber but not yet delivered.
+func (sub *Subscriber) Lag() int {
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	return len(sub.records) + sub.spilled
+}
+
+// Stats returns the metrics for the subscriber.
+func (sub *Subscriber) Stats() SubscriberStats {
+	return SubscriberStats{
+		Delivered: atomic.LoadInt64(&sub.delivered),
+		Dropped:   atomic.LoadInt64(&sub.dropped),
+		Spilled:   atomic.LoadInt64(&sub.spilledTotal),
+		Lag:       sub.Lag(),
+	}
+}
+
+// Close unsubscribes from the stream and removes any spilled blocks.
+func (sub *Subscriber) Close() error {
+	sub.once.Do(func() {
+		close(sub.done)
+	})
+
+	s := sub.Stream
+	s.mutex.Lock()
+	subscribers := make([]*Subscriber, 0, len(s.subscribers))
+	for _, x := range s.subscribers {
+		if x != sub {
+			subscribers = append(subscribers, x)
+		}
+	}
+	s.subscribers = subscribers
+	s.mutex.Unlock()
+
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+	sub.closed = true
+	if sub.spillIterator != nil {
+		sub.spillIterator.Close()
+		sub.spillBlock.Remove()
+		sub.spillIterator = nil
+		sub.spillBlock = nil
+	}
+	sub.pending = nil
+	if sub.spill != nil {
+		err := sub.spill.Close()
+		if err != nil {
+			return errors.Wrap(err, "Error closing spill stream")
+		}
+		err = sub.spill.Remove()
+		if err != nil {
+			return errors.Wrap(err, "Error removing spill stream")
+		}
+	}
+	return nil
+}
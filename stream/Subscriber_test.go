@@ -0,0 +1,164 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readSubscriber returns every object delivered to the subscriber until io.EOF.
+func readSubscriber(t *testing.T, sub *Subscriber) []string {
+	t.Helper()
+	objects := make([]string, 0)
+	for {
+		b, err := sub.Next()
+		if err != nil {
+			if err == io.EOF {
+				return objects
+			}
+			t.Fatal(err)
+		}
+		objects = append(objects, string(b))
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	for _, policy := range []string{PolicyBlock, PolicyDrop, PolicySpill} {
+		s := newTestStream(t, "snappy", "memory", 10)
+		sub, err := s.Subscribe(SubscribeOptions{Policy: policy, Capacity: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan []string, 1)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			done <- readSubscriber(t, sub)
+		}()
+		appendRecords(t, s, 0, 100)
+		s.Close()
+		objects := <-done
+		stats := sub.Stats()
+		if int64(len(objects))+stats.Dropped != 100 {
+			t.Fatal(policy, len(objects), stats)
+		}
+		if policy == PolicyDrop {
+			for i := 1; i < len(objects); i++ {
+				if objects[i] <= objects[i-1] {
+					t.Fatal("out of order", objects)
+				}
+			}
+		} else {
+			expectRecords(t, objects, 0, 100)
+		}
+		if policy == PolicySpill && stats.Spilled == 0 {
+			t.Fatal("expected records to spill", stats)
+		}
+		sub.Close()
+	}
+}
+
+func TestSubscribeDefaultCapacity(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	sub, err := s.Subscribe(SubscribeOptions{Policy: PolicyDrop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	appendRecords(t, s, 0, 10)
+	s.Close()
+	expectRecords(t, readSubscriber(t, sub), 0, 10)
+	if sub.Stats().Dropped != 0 {
+		t.Fatal(sub.Stats())
+	}
+}
+
+func TestSubscribeConcurrentWriters(t *testing.T) {
+	for _, policy := range []string{PolicyBlock, PolicySpill} {
+		s := newTestStream(t, "snappy", "memory", 50)
+		sub, err := s.Subscribe(SubscribeOptions{Policy: policy, Capacity: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan []string, 1)
+		go func() {
+			done <- readSubscriber(t, sub)
+		}()
+		wg := &sync.WaitGroup{}
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				appendRecords(t, s, w*100, (w+1)*100)
+			}(w)
+		}
+		wg.Wait()
+		s.Close()
+		objects := <-done
+		stored := readStream(t, s)
+		if len(objects) != len(stored) {
+			t.Fatal(policy, len(objects), len(stored))
+		}
+		for i := range stored {
+			if objects[i] != stored[i] {
+				t.Fatalf("%s: expected %q at position %d but found %q", policy, stored[i], i, objects[i])
+			}
+		}
+		sub.Close()
+	}
+}
+
+func TestSubscriberCloseWhileSpilling(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	sub, err := s.Subscribe(SubscribeOptions{Policy: PolicySpill, Capacity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 0, 50)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, err := sub.Next()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	err = sub.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	s.Close()
+}
+
+func TestSubscriberSpillToDisk(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	tempDir := t.TempDir()
+	sub, err := s.Subscribe(SubscribeOptions{Policy: PolicySpill, Capacity: 1, TempDir: tempDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subscriber does not read while the records are written, so they are spilled to file blocks.
+	appendRecords(t, s, 0, 1000)
+	if n := countFiles(t, tempDir); n != 99 {
+		t.Fatalf("expected 99 spilled blocks but found %d files", n)
+	}
+	if len(sub.pending) != 9 {
+		t.Fatalf("expected 9 pending records but found %d", len(sub.pending))
+	}
+	s.Close()
+	expectRecords(t, readSubscriber(t, sub), 0, 1000)
+	if n := countFiles(t, tempDir); n != 0 {
+		t.Fatalf("expected the spilled blocks to be removed but found %d files", n)
+	}
+	sub.Close()
+}
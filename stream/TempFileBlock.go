@@ -31,11 +31,7 @@ type TempFileBlock struct {
 
 // Size returns the number of bytes in the block, by using os.FileInfo.Size(), and an error if any.
 func (tfb *TempFileBlock) Size() (int64, error) {
-	f, err := os.Open(tfb.TempFile)
-	if err != nil {
-		return 0, errors.Wrap(err, "Error opening file block at \""+tfb.TempFile+"\" for reading")
-	}
-	fi, err := f.Stat()
+	fi, err := os.Stat(tfb.TempFile)
 	if err != nil {
 		return 0, errors.Wrap(err, "Error getting file info for file block at \""+tfb.TempFile+"\"")
 	}
@@ -57,7 +53,7 @@ func (tfb *TempFileBlock) Reader() (*Reader, error) {
 			return nil, errors.Wrap(err, "Error opening file block at \""+tfb.TempFile+"\" for reading")
 		}
 		gr, err := gzip.NewReader(bufio.NewReader(f))
-		if gr != nil {
+		if err != nil {
 			return nil, errors.Wrap(err, "Error creating gzip reader for temp file block.")
 		}
 		return &Reader{ReadCloser: gr, File: f}, nil
@@ -81,6 +77,7 @@ func (tfb *TempFileBlock) Iterator() (*BlockIterator, error) {
   it := &BlockIterator{
     Reader: reader,
     BigEndian: tfb.UseBigEndian(),
+    Transform: tfb.GetTransform(),
   }
 
   return it, nil
@@ -164,6 +161,7 @@ func (tfb *TempFileBlock) Remove() error {
 func NewTempFileBlock(algorithm string, bigEndian bool, tempDir string) *TempFileBlock {
   return &TempFileBlock{
 		AbstractBlock: AbstractBlock{
+			Count: -1,
 			Algorithm: algorithm,
 			BigEndian: bigEndian,
 		},
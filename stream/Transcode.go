@@ -0,0 +1,162 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"sync"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// TranscodeOptions are the options for Transcode.
+type TranscodeOptions struct {
+	Concurrency int // the number of blocks rewritten in parallel.  Defaults to 1.
+}
+
+// Transcode rewrites every block of the stream into the given compression algorithm and block type, block by block,
+// so peak memory is about one block per concurrent worker.  The order and number of objects in each block are kept,
+// so the rewritten blocks keep their identifiers and existing cursors remain valid.
+// Objects in the buffer are first rotated into a block, and new objects are written using the new algorithm and block type.
+// Blocks sealed while the stream is transcoded are rewritten before the swap, so every block uses the new algorithm and block type.
+// Iterators opened before the swap keep reading the old blocks, which are removed once those iterators are closed.
+// Blocks evicted while the stream is transcoded are not replaced.
+// If the stream has a Store, then the block type cannot be changed.
+func (s *Stream) Transcode(algorithm string, blockType string, options TranscodeOptions) error {
+
+	switch algorithm {
+	case "snappy", "gzip", "none":
+	default:
+		return errors.New("Unknown compression algorithm \"" + algorithm + "\"")
+	}
+
+	switch blockType {
+	case "memory", "file":
+	case "columnar":
+		if s.Extractor == nil {
+			return errors.New("Error transcoding to columnar blocks.  Extractor is nil.")
+		}
+	default:
+		return errors.New("Unknown block type \"" + blockType + "\"")
+	}
+
+	if s.Store != nil && blockType != s.BlockType {
+		return errors.New("Error transcoding to " + blockType + " blocks.  The block type cannot be changed while the stream has a Store.")
+	}
+
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	s.mutex.Lock()
+	if s.Buffer != nil && s.written > 0 {
+		err := s.rotate()
+		if err != nil {
+			s.mutex.Unlock()
+			return errors.Wrap(err, "Error rotating buffer to block")
+		}
+	}
+	blocks := s.Blocks
+	rewrites := s.rewrites
+	s.acquire(blocks)
+	s.mutex.Unlock()
+	defer s.release(blocks)
+
+	replacements := make([]Block, len(blocks))
+	errs := make([]error, len(blocks))
+	indices := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				block, err := s.rewrite([]Block{blocks[i]}, algorithm, blockType)
+				if err != nil {
+					errs[i] = errors.Wrap(err, "Error transcoding block "+fmt.Sprint(blocks[i].GetID()))
+					continue
+				}
+				block.SetID(blocks[i].GetID())
+				block.SetCreated(blocks[i].GetCreated())
+				block.SetWindow(blocks[i].GetWindow())
+				replacements[i] = block
+			}
+		}()
+	}
+	for i := range blocks {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			for _, block := range replacements {
+				if block != nil {
+					block.Remove()
+				}
+			}
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Seal the objects written during the transcode, and rewrite the blocks sealed since the snapshot.
+	if s.Buffer != nil && s.written > 0 {
+		err := s.rotate()
+		if err != nil {
+			for _, block := range replacements {
+				block.Remove()
+			}
+			return errors.Wrap(err, "Error rotating buffer to block")
+		}
+	}
+	snapshot := blocks
+	if evicted, ok := s.evictedFrom(blocks); ok {
+		tail := s.Blocks[len(blocks)-evicted:]
+		snapshot = append(blocks[:len(blocks):len(blocks)], tail...)
+		for _, block := range tail {
+			replacement, err := s.rewrite([]Block{block}, algorithm, blockType)
+			if err != nil {
+				for _, block := range replacements {
+					block.Remove()
+				}
+				return errors.Wrap(err, "Error transcoding block "+fmt.Sprint(block.GetID()))
+			}
+			replacement.SetID(block.GetID())
+			replacement.SetCreated(block.GetCreated())
+			replacement.SetWindow(block.GetWindow())
+			replacements = append(replacements, replacement)
+		}
+	}
+
+	groups := make([][]Block, 0, len(snapshot))
+	for _, block := range snapshot {
+		groups = append(groups, []Block{block})
+	}
+	_, err := s.swap(snapshot, rewrites, groups, replacements)
+	if err != nil {
+		return err
+	}
+
+	s.Algorithm = algorithm
+	s.BlockType = blockType
+	if s.Buffer != nil {
+		err := s.init()
+		if err != nil {
+			return errors.Wrap(err, "Error initializing buffer")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	appendRecords(t, s, 0, 95)
+	before, err := s.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 33; i++ {
+		before.Next()
+	}
+	c := before.Cursor()
+	end := 95
+	for _, target := range [][2]string{{"gzip", "file"}, {"none", "memory"}, {"snappy", "file"}} {
+		err := s.Transcode(target[0], target[1], TranscodeOptions{Concurrency: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendRecords(t, s, end, end+1)
+		end += 1
+		err = s.Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectRecords(t, readStream(t, s), 0, end)
+		// The order and number of objects in each block are kept, so cursors remain valid.
+		it, err := s.IteratorFrom(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectRecords(t, readAll(t, it), 33, end)
+		for _, block := range s.Blocks {
+			if _, ok := block.(*TempFileBlock); ok != (target[1] == "file") {
+				t.Fatalf("expected %s blocks but found %T", target[1], block)
+			}
+		}
+	}
+	expectRecords(t, readAll(t, before), 33, 90)
+}
+
+func TestTranscodeWrite(t *testing.T) {
+	s := newTestStream(t, "none", "memory", 10)
+	record := []byte(testRecord(0))
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint64(header, uint64(len(record)))
+	_, err := s.Write(append(header, record...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Transcode("gzip", "memory", TranscodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The objects written with Write are sealed into a block before the stream is transcoded.
+	expectRecords(t, readStream(t, s), 0, 1)
+}
+
+func TestTranscodeConcurrentWrites(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 5)
+	appendRecords(t, s, 0, 200)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		appendRecords(t, s, 200, 400)
+	}()
+	err := s.Transcode("gzip", "file", TranscodeOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	s.Close()
+	expectRecords(t, readStream(t, s), 0, 400)
+	for _, block := range s.Blocks {
+		if _, ok := block.(*TempFileBlock); !ok {
+			t.Fatalf("expected file blocks but found %T", block)
+		}
+	}
+}
+
+func TestTranscodeStore(t *testing.T) {
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Store = NewMemoryBlockStore()
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 0, 25)
+	err = s.Transcode("gzip", "file", TranscodeOptions{})
+	if err == nil {
+		t.Fatal("expected an error changing the block type of a stream with a Store")
+	}
+	err = s.Transcode("gzip", "memory", TranscodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, readStream(t, s), 0, 25)
+}
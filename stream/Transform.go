@@ -0,0 +1,114 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	TransformNone       = ""           // records are stored as is
+	TransformPrefix     = "prefix"     // records are stored as the length of the prefix shared with the previous record followed by the suffix
+	TransformDictionary = "dictionary" // repeated records are stored as an index into a dictionary of the distinct records in the block
+)
+
+// recordTransform encodes and decodes the records of one block before compression.
+// Records are encoded relative to the previous records of the same block, so a block is always decoded from its beginning.
+type recordTransform struct {
+	name       string
+	previous   []byte         // the previous record, used by the prefix transform
+	dictionary map[string]int // the index of every distinct record encoded so far, used by the dictionary transform
+	entries    [][]byte       // the distinct records decoded so far, used by the dictionary transform
+}
+
+// newRecordTransform returns a new recordTransform for a block, or nil if the name is empty.
+// Returns an error if the transform is unknown.
+func newRecordTransform(name string) (*recordTransform, error) {
+	switch name {
+	case TransformNone:
+		return nil, nil
+	case TransformPrefix:
+		return &recordTransform{name: name}, nil
+	case TransformDictionary:
+		return &recordTransform{name: name, dictionary: map[string]int{}}, nil
+	}
+	return nil, errors.New("Unknown record transform \"" + name + "\"")
+}
+
+// encode returns the encoded record.  Does not change the state of the transform until the record is added with add.
+func (t *recordTransform) encode(b []byte) []byte {
+	switch t.name {
+	case TransformPrefix:
+		shared := 0
+		for shared < len(b) && shared < len(t.previous) && b[shared] == t.previous[shared] {
+			shared++
+		}
+		out := make([]byte, binary.MaxVarintLen64+len(b)-shared)
+		n := binary.PutUvarint(out, uint64(shared))
+		n += copy(out[n:], b[shared:])
+		return out[:n]
+	case TransformDictionary:
+		if index, ok := t.dictionary[string(b)]; ok {
+			out := make([]byte, 1+binary.MaxVarintLen64)
+			out[0] = 1
+			n := 1 + binary.PutUvarint(out[1:], uint64(index))
+			return out[:n]
+		}
+		return append([]byte{0}, b...)
+	}
+	return b
+}
+
+// add adds the record to the state of the transform once its encoded bytes are written,
+// so the next record is encoded relative to it.
+func (t *recordTransform) add(b []byte) {
+	switch t.name {
+	case TransformPrefix:
+		t.previous = append(t.previous[:0], b...)
+	case TransformDictionary:
+		if _, ok := t.dictionary[string(b)]; !ok {
+			t.dictionary[string(b)] = len(t.dictionary)
+		}
+	}
+}
+
+// decode returns the record decoded from the encoded bytes, and an error if any.
+func (t *recordTransform) decode(b []byte) ([]byte, error) {
+	switch t.name {
+	case TransformPrefix:
+		shared, n := binary.Uvarint(b)
+		if n <= 0 || shared > uint64(len(t.previous)) {
+			return nil, errors.New("Invalid prefix encoded record.  Shared prefix exceeds length of previous record.")
+		}
+		record := make([]byte, 0, int(shared)+len(b)-n)
+		record = append(record, t.previous[:shared]...)
+		record = append(record, b[n:]...)
+		t.previous = record
+		return record, nil
+	case TransformDictionary:
+		if len(b) == 0 {
+			return nil, errors.New("Invalid dictionary encoded record.  Record is empty.")
+		}
+		if b[0] == 0 {
+			record := append(make([]byte, 0, len(b)-1), b[1:]...)
+			t.entries = append(t.entries, record)
+			return record, nil
+		}
+		index, n := binary.Uvarint(b[1:])
+		if n <= 0 || index >= uint64(len(t.entries)) {
+			return nil, errors.New("Invalid dictionary encoded record.  Index exceeds dictionary size " + fmt.Sprint(len(t.entries)) + ".")
+		}
+		return append(make([]byte, 0, len(t.entries[index])), t.entries[index]...), nil
+	}
+	return b, nil
+}
@@ -0,0 +1,92 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	for _, transform := range []string{"prefix", "dictionary"} {
+		for _, blockType := range []string{"memory", "file", "columnar"} {
+			s, err := New("snappy", "little", 10, blockType, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Transform = transform
+			s.Extractor = csvExtractor{}
+			err = s.Init()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := make([]string, 0, 25)
+			for i := 0; i < 25; i++ {
+				object := fmt.Sprintf("%d,n%d,t", 1000+i%5, i%3)
+				expected = append(expected, object)
+				err := s.Append([]byte(object))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.Close()
+			objects := readStream(t, s)
+			if fmt.Sprint(objects) != fmt.Sprint(expected) {
+				t.Fatalf("%s %s: expected %v but found %v", transform, blockType, expected, objects)
+			}
+			b, err := s.Get(17)
+			if err != nil || string(b) != expected[17] {
+				t.Fatal(string(b), err)
+			}
+		}
+	}
+}
+
+func TestTransformFollowIterator(t *testing.T) {
+	s, err := New("gzip", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Transform = "prefix"
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := s.Follow(context.Background())
+	defer it.Close()
+	done := make(chan []string, 1)
+	go func() {
+		objects := make([]string, 0)
+		for {
+			b, err := it.Next()
+			if err != nil {
+				done <- objects
+				return
+			}
+			objects = append(objects, string(b))
+		}
+	}()
+	for i := 0; i < 25; i++ {
+		appendRecords(t, s, i, i+1)
+		s.Flush()
+	}
+	s.Close()
+	expectRecords(t, <-done, 0, 25)
+}
+
+func TestTransformUnknown(t *testing.T) {
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Transform = "unknown"
+	if s.Init() == nil {
+		t.Fatal("expected an error for an unknown transform")
+	}
+}
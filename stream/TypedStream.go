@@ -0,0 +1,112 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+//go:build go1.18
+// +build go1.18
+
+package stream
+
+import (
+	"encoding"
+	"fmt"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// BinaryPointer is a constraint for a pointer to T that can marshal and unmarshal T.
+type BinaryPointer[T any] interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// TypedStream is a wrapper around a Stream that marshals and unmarshals values of type T.
+// P is the pointer type *T, which is usually inferred, e.g., NewTypedStream[Point](s).
+type TypedStream[T any, P BinaryPointer[T]] struct {
+	Stream *Stream `xml:"-" json:"-"`
+}
+
+// NewTypedStream returns a new TypedStream wrapping the stream.
+func NewTypedStream[T any, P BinaryPointer[T]](s *Stream) *TypedStream[T, P] {
+	return &TypedStream[T, P]{Stream: s}
+}
+
+// Append marshals the value and writes it to the stream.  Returns the number of bytes written, and an error if any.
+func (ts *TypedStream[T, P]) Append(v T) (int, error) {
+	b, err := P(&v).MarshalBinary()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error marshalling object to bytes.")
+	}
+	return ts.Stream.WriteRecord(b)
+}
+
+// Get returns the value at the given position, and an error if any.
+func (ts *TypedStream[T, P]) Get(position int) (T, error) {
+	var v T
+	err := ts.GetInto(position, &v)
+	return v, err
+}
+
+// GetInto unmarshals the value at the given position into dst, and returns an error if any.
+func (ts *TypedStream[T, P]) GetInto(position int, dst P) error {
+	b, err := ts.Stream.Get(position)
+	if err != nil {
+		return err
+	}
+	err = dst.UnmarshalBinary(b)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshalling object at position "+fmt.Sprint(position))
+	}
+	return nil
+}
+
+// Iterator returns a TypedIterator for iterating through the values in the stream, and an error if any.
+func (ts *TypedStream[T, P]) Iterator() (*TypedIterator[T, P], error) {
+	it, err := ts.Stream.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return NewTypedIterator[T, P](it), nil
+}
+
+// TypedIterator is a wrapper around an Iterator that unmarshals each object into a value of type T.
+type TypedIterator[T any, P BinaryPointer[T]] struct {
+	Iterator Iterator `xml:"-" json:"-"`
+}
+
+// NewTypedIterator returns a new TypedIterator wrapping the iterator.
+func NewTypedIterator[T any, P BinaryPointer[T]](it Iterator) *TypedIterator[T, P] {
+	return &TypedIterator[T, P]{Iterator: it}
+}
+
+// Next returns the next value, and an error if any.  Returns io.EOF when there are no more values.
+func (it *TypedIterator[T, P]) Next() (T, error) {
+	var v T
+	err := it.NextInto(&v)
+	return v, err
+}
+
+// NextInto unmarshals the next value into dst, and returns an error if any.
+// Reusing the same dst across calls avoids allocating a new value for every object.
+func (it *TypedIterator[T, P]) NextInto(dst P) error {
+	b, err := it.Iterator.Next()
+	if err != nil {
+		return err
+	}
+	err = dst.UnmarshalBinary(b)
+	if err != nil {
+		return errors.Wrap(err, "Error unmarshalling object.")
+	}
+	return nil
+}
+
+// Close closes the underlying iterator.
+func (it *TypedIterator[T, P]) Close() error {
+	return it.Iterator.Close()
+}
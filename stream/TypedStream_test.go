@@ -0,0 +1,74 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// testPoint is a point marshalled as two little-endian int32.
+type testPoint struct {
+	X int32
+	Y int32
+}
+
+func (p *testPoint) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, uint32(p.X))
+	binary.LittleEndian.PutUint32(b[4:], uint32(p.Y))
+	return b, nil
+}
+
+func (p *testPoint) UnmarshalBinary(b []byte) error {
+	p.X = int32(binary.LittleEndian.Uint32(b))
+	p.Y = int32(binary.LittleEndian.Uint32(b[4:]))
+	return nil
+}
+
+func TestTypedStream(t *testing.T) {
+	s := newTestStream(t, "snappy", "memory", 10)
+	ts := NewTypedStream[testPoint](s)
+	for i := 0; i < 25; i++ {
+		_, err := ts.Append(testPoint{X: int32(i), Y: int32(-i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (i+1)%10 == 0 {
+			s.Rotate()
+		}
+	}
+	s.Close()
+
+	p, err := ts.Get(13)
+	if err != nil || p.X != 13 || p.Y != -13 {
+		t.Fatal(p, err)
+	}
+
+	it, err := ts.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for i := 0; ; i++ {
+		err := it.NextInto(&p)
+		if err == io.EOF {
+			if i != 25 {
+				t.Fatalf("expected 25 points but found %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.X != int32(i) || p.Y != int32(-i) {
+			t.Fatalf("expected point %d but found %v", i, p)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// WAL is a write-ahead log of the objects written to the buffer of a stream since the last block was sealed.
+// Every object is framed by its length and CRC-32 checksum, as two big-endian uint32, followed by its bytes.
+// The log is truncated once the buffer is sealed into a block, and can be replayed into the buffer after a crash.
+type WAL struct {
+	Path         string        `xml:"-" json:"-"` // the path to the log file
+	SyncInterval time.Duration `xml:"-" json:"-"` // the maximum time between syncs to disk.  If zero, every object is synced.  If negative, the log is only synced by Sync and Close.
+	mutex        sync.Mutex
+	file         *os.File
+	lastSync     time.Time
+	dirty        bool          // true if objects were appended since the last sync
+	closed       bool          // true once the log is closed
+	done         chan struct{} // closed to stop syncing every SyncInterval
+}
+
+// OpenWAL opens the write-ahead log at the path, creating it if needed, and returns an error if any.
+func OpenWAL(path string, syncInterval time.Duration) (*WAL, error) {
+	pathExpanded, err := homedir.Expand(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error expanding path for write-ahead log at \""+path+"\"")
+	}
+	f, err := os.OpenFile(pathExpanded, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening write-ahead log at \""+pathExpanded+"\"")
+	}
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "Error seeking to end of write-ahead log at \""+pathExpanded+"\"")
+	}
+	w := &WAL{
+		Path:         pathExpanded,
+		SyncInterval: syncInterval,
+		file:         f,
+		lastSync:     time.Now(),
+		done:         make(chan struct{}),
+	}
+	if syncInterval > 0 {
+		go w.syncEvery(syncInterval)
+	}
+	return w, nil
+}
+
+// syncEvery syncs the objects appended to the log every interval until the log is closed,
+// so the last objects are synced even if no more objects are appended.
+func (w *WAL) syncEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mutex.Lock()
+			if w.dirty && !w.closed {
+				w.sync()
+			}
+			w.mutex.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Append writes the framed object to the end of the log, syncing it to disk as configured by SyncInterval.
+func (w *WAL) Append(b []byte) error {
+	_, err := w.append(b)
+	return err
+}
+
+// append writes the framed object to the end of the log, and returns the size of the log before the object,
+// which can be passed to rollback to remove the object.
+func (w *WAL) append(b []byte) (int64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	offset, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error seeking in write-ahead log at \""+w.Path+"\"")
+	}
+	frame := make([]byte, 8+len(b))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(b))
+	copy(frame[8:], b)
+	_, err = w.file.Write(frame)
+	w.dirty = true
+	if err != nil {
+		return offset, errors.Wrap(err, "Error writing object to write-ahead log at \""+w.Path+"\"")
+	}
+	if w.SyncInterval == 0 || (w.SyncInterval > 0 && time.Since(w.lastSync) >= w.SyncInterval) {
+		return offset, w.sync()
+	}
+	return offset, nil
+}
+
+// rollback removes the objects appended at or after the offset returned by append.
+func (w *WAL) rollback(offset int64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.truncate(offset)
+}
+
+// Sync syncs the log to disk.
+func (w *WAL) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.sync()
+}
+
+// sync syncs the log to disk.  The caller must hold the log's mutex.
+func (w *WAL) sync() error {
+	err := w.file.Sync()
+	if err != nil {
+		return errors.Wrap(err, "Error syncing write-ahead log at \""+w.Path+"\"")
+	}
+	w.lastSync = time.Now()
+	w.dirty = false
+	return nil
+}
+
+// Truncate removes every object from the log.
+func (w *WAL) Truncate() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.truncate(0)
+}
+
+// truncate truncates the log to the given size in bytes and syncs it.  The caller must hold the log's mutex.
+func (w *WAL) truncate(size int64) error {
+	err := w.file.Truncate(size)
+	if err != nil {
+		return errors.Wrap(err, "Error truncating write-ahead log at \""+w.Path+"\"")
+	}
+	_, err = w.file.Seek(size, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "Error seeking in write-ahead log at \""+w.Path+"\"")
+	}
+	return w.sync()
+}
+
+// Replay calls fn for every object in the log, in the order written, and returns the number of objects replayed.
+// A torn or corrupt frame at the end of the log, left by a crash during a write, is removed from the log.
+// A frame longer than the rest of the log is torn, so a corrupt length never allocates more than the size of the log.
+func (w *WAL) Replay(fn func(b []byte) error) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	fi, err := w.file.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error getting file info for write-ahead log at \""+w.Path+"\"")
+	}
+	size := fi.Size()
+
+	_, err = w.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error seeking to start of write-ahead log at \""+w.Path+"\"")
+	}
+	r := bufio.NewReader(w.file)
+
+	n := 0
+	valid := int64(0)
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return n, errors.Wrap(err, "Error reading frame header from write-ahead log at \""+w.Path+"\"")
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length > size-valid-8 {
+			break
+		}
+		b := make([]byte, length)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return n, errors.Wrap(err, "Error reading frame from write-ahead log at \""+w.Path+"\"")
+		}
+		if crc32.ChecksumIEEE(b) != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+		err = fn(b)
+		if err != nil {
+			return n, errors.Wrap(err, "Error replaying object "+fmt.Sprint(n)+" from write-ahead log")
+		}
+		n += 1
+		valid += int64(8 + len(b))
+	}
+
+	return n, w.truncate(valid)
+}
+
+// Close syncs and closes the log file.
+func (w *WAL) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	err := w.sync()
+	if err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+// Recover replays the objects in the write-ahead log into the buffer of the stream, and then attaches the log to the stream,
+// so that later objects are logged before they are buffered.  Returns the number of objects recovered, and an error if any.
+// The stream must be initialized with the same options it had before the crash, and no objects can have been written to the buffer.
+func (s *Stream) Recover(w *WAL) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Buffer == nil {
+		return 0, errors.New("Error recovering from write-ahead log.  Buffer is nil.")
+	}
+	if s.count > 0 {
+		return 0, errors.New("Error recovering from write-ahead log.  Buffer is not empty.")
+	}
+
+	n, err := w.Replay(func(b []byte) error {
+		if s.Sorted {
+			key := s.key(b)
+			s.lastKey = append(make([]byte, 0, len(key)), key...)
+		}
+		if s.Deduplicator != nil {
+			s.Deduplicator.Add(b)
+		}
+		if s.windowed() {
+			s.windowStart = s.Timestamp(b).Truncate(s.WindowSize)
+		}
+		_, err := s.writeRecord(b)
+		return err
+	})
+	if err != nil {
+		return n, errors.Wrap(err, "Error recovering from write-ahead log")
+	}
+
+	s.WAL = w
+	if n > 0 {
+		s.notify()
+	}
+	return n, nil
+}
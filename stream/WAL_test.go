@@ -0,0 +1,203 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingWriter is a writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("write failed")
+}
+
+func (failingWriter) Flush() error {
+	return nil
+}
+
+// recoverStream returns a new stream recovered from the write-ahead log at the path, and the number of objects recovered.
+func recoverStream(t *testing.T, path string) (*Stream, int) {
+	t.Helper()
+	w, err := OpenWAL(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestStream(t, "snappy", "memory", 10)
+	n, err := s.Recover(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, n
+}
+
+// appendToFile appends the bytes to the end of the file at the path.
+func appendToFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fileSize returns the size of the file at the path.
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+func TestWALRecover(t *testing.T) {
+	for _, tail := range [][]byte{{0, 0, 0, 9, 1, 2}, {0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0, 1, 2, 3}} {
+		path := filepath.Join(t.TempDir(), "wal")
+		w, err := OpenWAL(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newTestStream(t, "snappy", "memory", 10)
+		n, err := s.Recover(w)
+		if n != 0 || err != nil {
+			t.Fatal(n, err)
+		}
+		appendRecords(t, s, 0, 14)
+		// The process crashes, so the buffer is lost and the last frame is torn.
+		w.Close()
+		appendToFile(t, path, tail)
+
+		recovered, n := recoverStream(t, path)
+		if n != 4 {
+			t.Fatalf("expected 4 objects recovered but found %d", n)
+		}
+		appendRecords(t, recovered, 14, 15)
+		recovered.Close()
+		expectRecords(t, readStream(t, recovered), 10, 15)
+		if size := fileSize(t, path); size != 0 {
+			t.Fatalf("expected an empty log once the buffer is sealed but found %d bytes", size)
+		}
+		recovered.WAL.Close()
+	}
+}
+
+func TestWALSyncInterval(t *testing.T) {
+	w, err := OpenWAL(filepath.Join(t.TempDir(), "wal"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	err = w.Append([]byte(testRecord(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Append([]byte(testRecord(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last object is synced without another object being appended.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mutex.Lock()
+		dirty := w.dirty
+		w.mutex.Unlock()
+		if !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the log to be synced")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWALRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	w, err := OpenWAL(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestStream(t, "none", "memory", 10)
+	_, err = s.Recover(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 0, 3)
+	size := fileSize(t, path)
+	writer := s.Writer
+	s.Writer = failingWriter{}
+	_, err = s.WriteRecord([]byte(testRecord(3)))
+	if err == nil {
+		t.Fatal("expected an error from the writer")
+	}
+	s.Writer = writer
+	if after := fileSize(t, path); after != size {
+		t.Fatalf("expected the failed object to be removed from the log, but the log grew from %d to %d bytes", size, after)
+	}
+	w.Close()
+	_, n := recoverStream(t, path)
+	if n != 3 {
+		t.Fatalf("expected 3 objects recovered but found %d", n)
+	}
+}
+
+func TestWALRollbackState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	w, err := OpenWAL(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New("snappy", "little", 10, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Sorted = true
+	s.Transform = "prefix"
+	s.Deduplicator, err = NewDeduplicator(DedupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Recover(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, s, 0, 3)
+	writer := s.Writer
+	s.Writer = failingWriter{}
+	_, err = s.WriteRecord([]byte(testRecord(5)))
+	if err == nil {
+		t.Fatal("expected an error from the writer")
+	}
+	s.Writer = writer
+	// The failed object is neither the last key of the sorted stream nor a duplicate.
+	appendRecords(t, s, 3, 6)
+	if s.Deduplicator.Dropped != 0 {
+		t.Fatalf("expected no duplicates but found %d", s.Deduplicator.Dropped)
+	}
+	w.Close()
+	_, n := recoverStream(t, path)
+	if n != 6 {
+		t.Fatalf("expected 6 objects recovered but found %d", n)
+	}
+	s.Close()
+	expectRecords(t, readStream(t, s), 0, 6)
+}
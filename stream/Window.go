@@ -0,0 +1,42 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"time"
+)
+
+import (
+	"github.com/pkg/errors"
+)
+
+// windowed returns true if the buffer is rotated by the time window of the objects.
+func (s *Stream) windowed() bool {
+	return s.Timestamp != nil && s.WindowSize > 0
+}
+
+// Window returns an iterator over the objects in the stream with a timestamp, returned by Timestamp,
+// from the inclusive start up to the exclusive end.  Blocks whose window does not overlap the range are skipped without being read.
+// Blocks without a window, such as blocks added with AppendBlock, are always read.
+// Sliding windows can be read by calling Window with overlapping ranges over a stream of tumbling windows.
+func (s *Stream) Window(from time.Time, to time.Time) (Iterator, error) {
+	if s.Timestamp == nil {
+		return nil, errors.New("Error iterating through window.  Timestamp is nil.")
+	}
+	timestamp := s.Timestamp
+	return s.scan(func(block Block) bool {
+		start, end := block.GetWindow()
+		if start.IsZero() && end.IsZero() {
+			return true
+		}
+		return start.Before(to) && end.After(from)
+	}, func(b []byte) bool {
+		t := timestamp(b)
+		return !t.Before(from) && t.Before(to)
+	}), nil
+}
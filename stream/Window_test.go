@@ -0,0 +1,77 @@
+// =================================================================
+//
+// Copyright (C) 2018 Spatial Current, Inc. - All Rights Reserved
+// Released as open source under the MIT License.  See LICENSE file.
+//
+// =================================================================
+
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newWindowedStream returns a new closed stream with one-minute windows of the objects 0, 10, ..., 290,
+// whose timestamps are their values in seconds.
+func newWindowedStream(t *testing.T) *Stream {
+	t.Helper()
+	s, err := New("snappy", "little", 3, "memory", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Timestamp = func(b []byte) time.Time {
+		n, _ := strconv.Atoi(string(b))
+		return time.Unix(int64(n), 0)
+	}
+	s.WindowSize = time.Minute
+	err = s.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i += 10 {
+		err := s.Append([]byte(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	return s
+}
+
+func TestWindowRotation(t *testing.T) {
+	s := newWindowedStream(t)
+	// The block size is ignored, so every block holds one window.
+	if len(s.Blocks) != 5 {
+		t.Fatalf("expected 5 blocks but found %d", len(s.Blocks))
+	}
+	start, end := s.Blocks[1].GetWindow()
+	if start.Unix() != 60 || end.Unix() != 120 || s.Blocks[1].GetCount() != 6 {
+		t.Fatal(start, end, s.Blocks[1].GetCount())
+	}
+}
+
+func TestWindow(t *testing.T) {
+	s := newWindowedStream(t)
+	it, err := s.Window(time.Unix(100, 0), time.Unix(130, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objects := fmt.Sprint(readAll(t, it)); objects != "[100 110 120]" {
+		t.Fatal(objects)
+	}
+}
+
+func TestWindowCompact(t *testing.T) {
+	s := newWindowedStream(t)
+	// Blocks of different windows are never compacted together.
+	err := s.Compact(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Blocks) != 5 {
+		t.Fatalf("expected 5 blocks but found %d", len(s.Blocks))
+	}
+}